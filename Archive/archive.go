@@ -0,0 +1,461 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// An archive file stores individuals from a population, possibly from many generations.
+// The genome of every individual is compressed separately, and an index at the end of the
+// file makes it possible to get one individual by id without decompressing everything else.
+//
+// File layout:
+//
+//	header: magic, version
+//	genomes: one deflate stream per individual
+//	index: number of entries, and then for every entry the metadata and genome location
+//	footer: file offset of the index, magic
+package archive
+
+import (
+	"Aldcran/VirtualMachine"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const (
+	magic   = "ALDCRANA"
+	version = 1
+)
+
+var ErrNotFound = errors.New("archive: no such id")
+
+// An individual. The genome is the MarshalBinary encoding of the program.
+type Entry struct {
+	Id         uint64
+	Generation int
+	Fitness    float64 // NaN if the individual was rejected without being evaluated
+	Penalties  int
+	Parents    []uint64
+	Operator   string    // The genetic operators that created the individual, empty for a random individual
+	Delta      float64   // Fitness change from the best parent, negative is an improvement
+	Rates      *vm.Rates // Mutation rates, if self adaptive mutation is used
+	Genome     []byte
+}
+
+// Location of a genome in the file
+type location struct {
+	offset     int64
+	compressed int64
+	size       int64
+}
+
+type Writer struct {
+	w      *bufio.Writer
+	file   *os.File // Only set if the file was created by the Writer
+	rename string   // File to replace with file when closed, used by Append
+	offset int64
+	index  []Entry // The genomes are not kept
+	where  []location
+	ids    map[uint64]bool
+}
+
+type Reader struct {
+	r       io.ReaderAt
+	file    *os.File
+	entries []Entry
+	where   []location
+	ids     map[uint64]int
+}
+
+func Create(name string) (*Writer, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.file = f
+	return w, nil
+}
+
+// Continue an existing archive, or create a new if it does not exist. The entries for
+// which keep returns true are copied to a new file, which replaces the old when the
+// Writer is closed. A nil keep copies all entries. The genomes are copied as they are
+// stored, without compressing them again.
+func Append(name string, keep func(e Entry) bool) (*Writer, error) {
+	r, err := Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return Create(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err == nil {
+		w.file = f
+		w.rename = name
+		for i, e := range r.entries {
+			if keep != nil && !keep(e) {
+				continue
+			}
+			loc := r.where[i]
+			data := make([]byte, loc.compressed)
+			if _, err = r.r.ReadAt(data, loc.offset); err != nil {
+				break
+			}
+			if err = w.add(e, data, loc.size); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return w, nil
+}
+
+// Continue an archive in place, from the given size as returned by Writer.Size after
+// Flush or Close. Anything in the file after that, like entries from a run that crashed,
+// is removed.
+func AppendAt(name string, size int64) (*Writer, error) {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f, size)
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &Writer{w: bufio.NewWriter(f), file: f, offset: size, ids: make(map[uint64]bool)}
+	for i, e := range r.entries {
+		w.ids[e.Id] = true
+		w.index = append(w.index, e)
+		w.where = append(w.where, r.where[i])
+	}
+	return w, nil
+}
+
+// Close has to be called to write the index. It does not close w.
+func NewWriter(w io.Writer) (*Writer, error) {
+	aw := &Writer{w: bufio.NewWriter(w), ids: make(map[uint64]bool)}
+	if err := aw.write([]byte(magic)); err != nil {
+		return nil, err
+	}
+	if err := aw.write(binary.LittleEndian.AppendUint32(nil, version)); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.w.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+// Add an individual. Every id may only be used once in an archive.
+func (w *Writer) Add(e Entry) error {
+	var buf bytes.Buffer
+	zw, _ := flate.NewWriter(&buf, flate.BestCompression)
+	zw.Write(e.Genome)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return w.add(e, buf.Bytes(), int64(len(e.Genome)))
+}
+
+// Add an individual with a compressed genome of the given uncompressed size
+func (w *Writer) add(e Entry, compressed []byte, size int64) error {
+	if w.ids[e.Id] {
+		return fmt.Errorf("archive: duplicate id %d", e.Id)
+	}
+	loc := location{offset: w.offset, compressed: int64(len(compressed)), size: size}
+	if err := w.write(compressed); err != nil {
+		return err
+	}
+	w.ids[e.Id] = true
+	e.Genome = nil
+	e.Parents = append([]uint64(nil), e.Parents...)
+	if e.Rates != nil {
+		rates := *e.Rates
+		e.Rates = &rates
+	}
+	w.index = append(w.index, e)
+	w.where = append(w.where, loc)
+	return nil
+}
+
+// Write the index and footer, so that the file is a complete archive with the entries
+// added so far. More entries can be added after that, followed by a new index. The old
+// index remains in the file, unused.
+func (w *Writer) Flush() error {
+	indexOffset := w.offset
+	buf := binary.AppendUvarint(nil, uint64(len(w.index)))
+	for i, e := range w.index {
+		buf = binary.LittleEndian.AppendUint64(buf, e.Id)
+		buf = binary.AppendVarint(buf, int64(e.Generation))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(e.Fitness))
+		buf = binary.AppendVarint(buf, int64(e.Penalties))
+		buf = binary.AppendUvarint(buf, uint64(len(e.Parents)))
+		for _, parent := range e.Parents {
+			buf = binary.LittleEndian.AppendUint64(buf, parent)
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(e.Operator)))
+		buf = append(buf, e.Operator...)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(e.Delta))
+		if e.Rates == nil {
+			buf = append(buf, 0)
+		} else {
+			rates, _ := e.Rates.MarshalBinary()
+			buf = append(append(buf, 1), rates...)
+		}
+		loc := w.where[i]
+		buf = binary.AppendUvarint(buf, uint64(loc.offset))
+		buf = binary.AppendUvarint(buf, uint64(loc.compressed))
+		buf = binary.AppendUvarint(buf, uint64(loc.size))
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(indexOffset))
+	buf = append(buf, magic...)
+	if err := w.write(buf); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// Number of bytes written. After Flush or Close, it is the size of a complete archive,
+// which can be continued with AppendAt.
+func (w *Writer) Size() int64 {
+	return w.offset
+}
+
+// Write the index and footer, and close the file if the Writer created it
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.file != nil {
+		if err2 := w.file.Close(); err == nil {
+			err = err2
+		}
+	}
+	if w.rename != "" {
+		if err == nil {
+			err = os.Rename(w.file.Name(), w.rename)
+		} else {
+			os.Remove(w.file.Name())
+		}
+	}
+	return err
+}
+
+func Open(name string) (*Reader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r, err := NewReader(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.file = f
+	return r, nil
+}
+
+// Read the index of an archive with the given size
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	const footerSize = 8 + len(magic)
+	if size < int64(len(magic)+4+footerSize) {
+		return nil, errors.New("archive: file too short")
+	}
+	header := make([]byte, len(magic)+4)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, errors.New("archive: not an archive file")
+	}
+	v := binary.LittleEndian.Uint32(header[len(magic):])
+	if v != version {
+		return nil, fmt.Errorf("archive: unsupported version %d", v)
+	}
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-int64(footerSize)); err != nil {
+		return nil, err
+	}
+	if string(footer[8:]) != magic {
+		return nil, errors.New("archive: missing index, the archive was not closed")
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer))
+	if indexOffset < int64(len(header)) || indexOffset > size-int64(footerSize) {
+		return nil, errors.New("archive: invalid index offset")
+	}
+	index := make([]byte, size-int64(footerSize)-indexOffset)
+	if _, err := r.ReadAt(index, indexOffset); err != nil {
+		return nil, err
+	}
+	ar := &Reader{r: r, ids: make(map[uint64]int)}
+	if err := ar.parseIndex(bytes.NewReader(index), indexOffset); err != nil {
+		return nil, err
+	}
+	return ar, nil
+}
+
+func (r *Reader) parseIndex(b *bytes.Reader, indexOffset int64) (err error) {
+	u64 := func() uint64 {
+		var v uint64
+		if err == nil {
+			err = binary.Read(b, binary.LittleEndian, &v)
+		}
+		return v
+	}
+	uvarint := func() uint64 {
+		var v uint64
+		if err == nil {
+			v, err = binary.ReadUvarint(b)
+		}
+		return v
+	}
+	varint := func() int64 {
+		var v int64
+		if err == nil {
+			v, err = binary.ReadVarint(b)
+		}
+		return v
+	}
+	count := uvarint()
+	for i := uint64(0); i < count && err == nil; i++ {
+		var e Entry
+		e.Id = u64()
+		e.Generation = int(varint())
+		e.Fitness = math.Float64frombits(u64())
+		e.Penalties = int(varint())
+		nparents := uvarint()
+		if nparents > uint64(b.Len()) {
+			return errors.New("archive: corrupt index")
+		}
+		for j := uint64(0); j < nparents; j++ {
+			e.Parents = append(e.Parents, u64())
+		}
+		n := uvarint()
+		if n > uint64(b.Len()) {
+			return errors.New("archive: corrupt index")
+		}
+		operator := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(b, operator)
+		}
+		e.Operator = string(operator)
+		e.Delta = math.Float64frombits(u64())
+		var hasRates byte
+		if err == nil {
+			hasRates, err = b.ReadByte()
+		}
+		if err == nil && hasRates > 1 {
+			return errors.New("archive: corrupt index")
+		}
+		if err == nil && hasRates == 1 {
+			data := make([]byte, vm.RatesSize)
+			if _, err = io.ReadFull(b, data); err == nil {
+				e.Rates = new(vm.Rates)
+				err = e.Rates.UnmarshalBinary(data)
+			}
+		}
+		// Checked before conversion to int64, where large values would turn negative
+		offset, compressed, size := uvarint(), uvarint(), uvarint()
+		if err == nil && (offset > uint64(indexOffset) || compressed > uint64(indexOffset)-offset || size > maxGenomeSize) {
+			return errors.New("archive: corrupt index")
+		}
+		if _, ok := r.ids[e.Id]; ok && err == nil {
+			return fmt.Errorf("archive: corrupt index, duplicate id %d", e.Id)
+		}
+		loc := location{offset: int64(offset), compressed: int64(compressed), size: int64(size)}
+		r.ids[e.Id] = len(r.entries)
+		r.entries = append(r.entries, e)
+		r.where = append(r.where, loc)
+	}
+	if err != nil {
+		return fmt.Errorf("archive: corrupt index: %v", err)
+	}
+	return nil
+}
+
+// Protect against allocating huge buffers from corrupt files
+const maxGenomeSize = 1 << 24
+
+// All entries in the order they were added. The genomes are not loaded.
+func (r *Reader) Entries() []Entry {
+	return r.entries
+}
+
+// Get an individual, including the genome
+func (r *Reader) Get(id uint64) (Entry, error) {
+	i, ok := r.ids[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	e := r.entries[i]
+	loc := r.where[i]
+	zr := flate.NewReader(io.NewSectionReader(r.r, loc.offset, loc.compressed))
+	defer zr.Close()
+	e.Genome = make([]byte, loc.size)
+	if _, err := io.ReadFull(zr, e.Genome); err != nil {
+		return Entry{}, fmt.Errorf("archive: id %d: %v", id, err)
+	}
+	return e, nil
+}
+
+// The uncompressed size of a genome, or -1 if the id is not found
+func (r *Reader) Size(id uint64) int {
+	i, ok := r.ids[id]
+	if !ok {
+		return -1
+	}
+	return int(r.where[i].size)
+}
+
+func (r *Reader) Close() error {
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package archive
+
+import (
+	"Aldcran/VirtualMachine"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func testEntries() []Entry {
+	var entries []Entry
+	for i := 0; i < 20; i++ {
+		genome := make([]byte, 14*(i+1))
+		rand.Read(genome)
+		entries = append(entries, Entry{
+			Id:         uint64(100 + i),
+			Generation: i / 5,
+			Fitness:    float64(i) * 1.5,
+			Penalties:  i * 100,
+			Parents:    []uint64{uint64(i), uint64(i + 1)},
+			Operator:   []string{"", "merge+bit"}[i%2],
+			Delta:      float64(i) - 10,
+			Rates:      []*vm.Rates{nil, {Bit: float64(i) / 100, Structural: 2}}[i%2],
+			Genome:     genome,
+		})
+	}
+	return entries
+}
+
+func equal(a, b Entry) bool {
+	if a.Id != b.Id || a.Generation != b.Generation || a.Fitness != b.Fitness || a.Penalties != b.Penalties || a.Operator != b.Operator || a.Delta != b.Delta {
+		return false
+	}
+	if len(a.Parents) != len(b.Parents) || !bytes.Equal(a.Genome, b.Genome) {
+		return false
+	}
+	if (a.Rates == nil) != (b.Rates == nil) || a.Rates != nil && *a.Rates != *b.Rates {
+		return false
+	}
+	for i := range a.Parents {
+		if a.Parents[i] != b.Parents[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestArchive(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "population.ald")
+	w, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := testEntries()
+	for _, e := range entries {
+		if err := w.Add(e); err != nil {
+			t.Fatal("Add returned", err)
+		}
+	}
+	if err := w.Add(entries[0]); err == nil {
+		t.Error("Expected error from duplicate id")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("Close returned", err)
+	}
+
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal("Open returned", err)
+	}
+	defer r.Close()
+	list := r.Entries()
+	if len(list) != len(entries) {
+		t.Fatal("Expected", len(entries), "entries, got", len(list))
+	}
+	for i, e := range list {
+		if e.Genome != nil {
+			t.Error("Entries shall not load the genomes")
+		}
+		e.Genome = entries[i].Genome
+		if !equal(e, entries[i]) {
+			t.Error("Expected", entries[i], "got", e)
+		}
+	}
+	// Get them in another order than they were added
+	for i := len(entries) - 1; i >= 0; i-- {
+		e, err := r.Get(entries[i].Id)
+		if err != nil {
+			t.Fatal("Get returned", err)
+		}
+		if !equal(e, entries[i]) {
+			t.Error("Expected", entries[i], "got", e)
+		}
+	}
+	if _, err := r.Get(1); err != ErrNotFound {
+		t.Error("Expected ErrNotFound, got", err)
+	}
+}
+
+func TestArchiveCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf)
+	for _, e := range testEntries() {
+		w.Add(e)
+	}
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Error("Expected error from archive without index")
+	}
+	w.Close()
+	data := buf.Bytes()
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Error("NewReader returned", err)
+	}
+	if _, err := NewReader(bytes.NewReader(data[1:]), int64(len(data)-1)); err == nil {
+		t.Error("Expected error from missing header")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "population.ald")
+	entries := testEntries()
+	for i, part := range [][]Entry{entries[:12], entries[12:]} {
+		w, err := Append(name, nil)
+		if err != nil {
+			t.Fatal("Append", i, "returned", err)
+		}
+		for _, e := range part {
+			w.Add(e)
+		}
+		if err := w.Add(entries[0]); err == nil {
+			t.Error("Expected error from duplicate id of an earlier run")
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.Entries()) != len(entries) {
+		t.Fatal("Expected", len(entries), "entries, got", len(r.Entries()))
+	}
+	for _, expected := range entries {
+		if e, err := r.Get(expected.Id); err != nil || !equal(e, expected) {
+			t.Error("Expected", expected, "got", e, err)
+		}
+	}
+	if files, _ := filepath.Glob(name + "*"); len(files) != 1 {
+		t.Error("Expected no temporary files, got", files)
+	}
+}
+
+// Entries that are not kept are dropped from the archive, and their ids can be used again
+func TestAppendKeep(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "population.ald")
+	entries := testEntries()
+	w, _ := Append(name, nil)
+	for _, e := range entries {
+		w.Add(e)
+	}
+	w.Close()
+	w, err := Append(name, func(e Entry) bool { return e.Generation <= 1 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(entries[15]); err != nil {
+		t.Error("Expected to add an entry that was dropped, got", err)
+	}
+	w.Close()
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.Entries()) != 11 {
+		t.Error("Expected 10 kept entries and 1 added, got", len(r.Entries()))
+	}
+	for _, e := range r.Entries() {
+		if e.Generation > 1 && e.Id != entries[15].Id {
+			t.Error("Entry", e.Id, "from generation", e.Generation, "was kept")
+		}
+	}
+}
+
+// An archive that is flushed is complete, and can be continued in place from that size
+// after more entries have been written
+func TestAppendAt(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "population.ald")
+	entries := testEntries()
+	crashed, _ := Create(name)
+	defer crashed.file.Close()
+	for _, e := range entries[:12] {
+		crashed.Add(e)
+	}
+	if err := crashed.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	size := crashed.Size()
+	if r, err := Open(name); err != nil || len(r.Entries()) != 12 {
+		t.Fatal("Expected a complete archive after Flush, got", err)
+	} else {
+		r.Close()
+	}
+	for _, e := range entries[12:] {
+		crashed.Add(e) // Never closed, as if the program crashed
+	}
+	crashed.w.Flush()
+	w, err := AppendAt(name, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries[12:] {
+		if err := w.Add(e); err != nil {
+			t.Error("Expected to add an entry after the size, got", err)
+		}
+	}
+	if err := w.Add(entries[0]); err == nil {
+		t.Error("Expected error from duplicate id before the size")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.Entries()) != len(entries) {
+		t.Fatal("Expected", len(entries), "entries, got", len(r.Entries()))
+	}
+	for _, expected := range entries {
+		if e, err := r.Get(expected.Id); err != nil || !equal(e, expected) {
+			t.Error("Expected", expected, "got", e, err)
+		}
+	}
+	if _, err := AppendAt(name, size-1); err == nil {
+		t.Error("Expected error from a size without an index")
+	}
+}
+
+// An archive with empty genomes at the given offset, and the given rates flag. The
+// offset of the index is 12, after the header.
+func withIndex(ids []uint64, offset uint64, hasRates byte) []byte {
+	data := append([]byte(magic), version, 0, 0, 0)
+	index := len(data)
+	data = binary.AppendUvarint(data, uint64(len(ids)))
+	for _, id := range ids {
+		data = binary.LittleEndian.AppendUint64(data, id)
+		data = binary.AppendVarint(data, 3)
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(2.5))
+		data = binary.AppendVarint(data, 0)
+		data = binary.AppendUvarint(data, 1)
+		data = binary.LittleEndian.AppendUint64(data, 6)
+		data = binary.AppendUvarint(data, 0)
+		data = binary.LittleEndian.AppendUint64(data, math.Float64bits(0))
+		data = append(data, hasRates)
+		data = binary.AppendUvarint(data, offset)
+		data = binary.AppendUvarint(data, 0)
+		data = binary.AppendUvarint(data, 0)
+	}
+	data = binary.LittleEndian.AppendUint64(data, uint64(index))
+	return append(data, magic...)
+}
+
+func TestArchiveCorruptIndex(t *testing.T) {
+	for _, data := range [][]byte{
+		withIndex([]uint64{7, 8, 7}, 12, 0), // Duplicate id
+		withIndex([]uint64{7}, 1<<63+1, 0),  // Offset that is negative as int64
+		withIndex([]uint64{7}, 12, 2),       // Invalid rates flag
+		withIndex([]uint64{7}, 12, 1),       // Missing rates
+	} {
+		if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+			t.Error("Expected error from corrupt index")
+		}
+	}
+	data := withIndex([]uint64{7}, 12, 0) // Empty genome, at the index
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := r.Entries()[0]; e.Id != 7 || e.Generation != 3 || e.Fitness != 2.5 || e.Parents[0] != 6 || e.Rates != nil {
+		t.Error("Unexpected entry", e)
+	}
+	data[len(magic)] = 2
+	if _, err := NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("Expected error from an unsupported version")
+	}
+}
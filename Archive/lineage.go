@@ -0,0 +1,94 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package archive
+
+// Analysis of the genealogy recorded in an archive
+
+import (
+	"sort"
+)
+
+// The genetic operators that produced individuals, and how much they improved the fitness
+type OperatorStats struct {
+	Operator     string
+	Children     int
+	Improvements int     // Children that were better than the best parent
+	Gain         float64 // The sum of all improvements
+}
+
+// The individual with the given id and all its ancestors that are in the archive, sorted
+// on generation with the latest first
+func Ancestry(entries []Entry, id uint64) []Entry {
+	byId := make(map[uint64]Entry, len(entries))
+	for _, e := range entries {
+		byId[e.Id] = e
+	}
+	var ret []Entry
+	seen := map[uint64]bool{id: true}
+	queue := []uint64{id}
+	for len(queue) > 0 {
+		e, ok := byId[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		ret = append(ret, e)
+		for _, p := range e.Parents {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Generation > ret[j].Generation
+	})
+	return ret
+}
+
+// Statistics for every combination of operators, sorted on gain with the largest first.
+// Individuals without parents are not counted.
+func Contributions(entries []Entry) []OperatorStats {
+	stats := make(map[string]*OperatorStats)
+	var ret []OperatorStats
+	for _, e := range entries {
+		if len(e.Parents) == 0 {
+			continue
+		}
+		s, ok := stats[e.Operator]
+		if !ok {
+			s = &OperatorStats{Operator: e.Operator}
+			stats[e.Operator] = s
+		}
+		s.Children++
+		if e.Delta < 0 {
+			s.Improvements++
+			s.Gain -= e.Delta
+		}
+	}
+	for _, s := range stats {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Gain != ret[j].Gain {
+			return ret[i].Gain > ret[j].Gain
+		}
+		return ret[i].Operator < ret[j].Operator
+	})
+	return ret
+}
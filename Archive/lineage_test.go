@@ -0,0 +1,62 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package archive
+
+import (
+	"testing"
+)
+
+func TestLineage(t *testing.T) {
+	entries := []Entry{
+		{Id: 1},
+		{Id: 2},
+		{Id: 3, Generation: 1, Parents: []uint64{1}, Operator: "bit", Delta: -2},
+		{Id: 4, Generation: 1, Parents: []uint64{2}, Operator: "bit", Delta: 1},
+		{Id: 5, Generation: 2, Parents: []uint64{3, 2}, Operator: "merge", Delta: -0.5},
+		{Id: 6, Generation: 2, Parents: []uint64{4}, Operator: "", Delta: 0},
+		{Id: 7, Generation: 3, Parents: []uint64{5}, Operator: "structural", Delta: -1},
+	}
+	var ids []uint64
+	for _, e := range Ancestry(entries, 7) {
+		ids = append(ids, e.Id)
+	}
+	expected := []uint64{7, 5, 3, 2, 1}
+	if len(ids) != len(expected) {
+		t.Fatal("Expected ancestry", expected, "got", ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Error("Expected ancestry", expected, "got", ids)
+			break
+		}
+	}
+
+	stats := Contributions(entries)
+	if len(stats) != 4 {
+		t.Fatal("Expected 4 operators, got", stats)
+	}
+	if s := stats[0]; s.Operator != "bit" || s.Children != 2 || s.Improvements != 1 || s.Gain != 2 {
+		t.Error("Expected bit first, got", s)
+	}
+	if s := stats[1]; s.Operator != "structural" || s.Gain != 1 {
+		t.Error("Expected structural second, got", s)
+	}
+	if s := stats[3]; s.Operator != "" || s.Improvements != 0 {
+		t.Error("Expected copies last, got", s)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Closed loop control. An evolved program is the controller of an environment, and
+// runs once every time step. Observations are written to the input cells, and actions
+// are read from the output cells. The memory is not cleared between the steps of an
+// episode, so the program can keep state.
+package control
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"math/rand"
+)
+
+// A simulated system to control. The values are integers, as used by the virtual machine.
+type Environment interface {
+	Reset(r *rand.Rand) // Start a new episode, r can be used for random initial conditions
+	Observe() []int
+	Act(action []int) // Apply the action and advance one time step
+	Reward() float64  // The reward of the last step. It is at most 0, where 0 is perfect.
+	Done() bool       // True if the episode has ended, e.g. because of a failure
+}
+
+// Evaluation of controllers on an environment. A Task can be used as a fitness.Objective.
+type Task struct {
+	New      func() Environment // Every episode uses a new environment
+	Layout   vm.Layout          // Input cells get the observations, and output cells are the actions
+	Episodes int
+	Steps    int     // Maximum number of steps in an episode
+	Early    float64 // Error for every step that remains when an episode is done early
+	Seed     int64   // Initial conditions are the same for all programs
+	Penalty  float64 // Weight of the VM penalties
+}
+
+// The total reward of an episode
+type Episode struct {
+	Reward float64
+	Steps  int
+}
+
+// Run one episode with the program given by genome, starting from cleared memory
+func (t *Task) Run(m *vm.VirtualMachine, genome []byte, r *rand.Rand) (ep Episode, penalties int, cost int) {
+	p := m.NewProgram()
+	p.UnmarshalBinary(genome)
+	env := t.New()
+	env.Reset(r)
+	m.Reset()
+	for ep.Steps < t.Steps && !env.Done() {
+		action, pen, c := p.Call(t.Layout, env.Observe())
+		env.Act(action)
+		ep.Reward += env.Reward()
+		ep.Steps++
+		penalties += pen
+		cost += c
+	}
+	return
+}
+
+// The error of every episode is the negated reward, and Early for every step that was not run
+func (t *Task) Evaluate(m *vm.VirtualMachine, genome []byte) (r fitness.Result) {
+	rng := rand.New(rand.NewSource(t.Seed))
+	for i := 0; i < t.Episodes; i++ {
+		ep, penalties, cost := t.Run(m, genome, rng)
+		e := -ep.Reward + t.Early*float64(t.Steps-ep.Steps)
+		r.Errors = append(r.Errors, e)
+		r.Error += e
+		r.Penalties += penalties
+		r.Cost += cost
+	}
+	r.Fitness = r.Error + t.Penalty*float64(r.Penalties)
+	return
+}
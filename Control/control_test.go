@@ -0,0 +1,126 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package control
+
+import (
+	"Aldcran/Evolve"
+	"Aldcran/VirtualMachine"
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// Remembers the actions
+type recorder struct {
+	actions []int
+}
+
+func (r *recorder) Reset(*rand.Rand) {}
+func (r *recorder) Observe() []int   { return []int{len(r.actions)} }
+func (r *recorder) Act(action []int) { r.actions = append(r.actions, action[0]) }
+func (r *recorder) Reward() float64  { return -1 }
+func (r *recorder) Done() bool       { return len(r.actions) == 3 }
+
+func genome(t *testing.T, m *vm.VirtualMachine, source string) []byte {
+	p := m.NewProgram()
+	if err := json.Unmarshal([]byte(source), p); err != nil {
+		t.Fatal(err)
+	}
+	g, _ := p.MarshalBinary()
+	return g
+}
+
+func TestTask(t *testing.T) {
+	m := vm.New(16, 8)
+	// A counter in cell 5, which is kept between the steps
+	g := genome(t, m, `{"instructions": [{"addImmediate": 1, "addIndirect": 5, "storeAddress": 5}]}`)
+	var rec *recorder
+	task := &Task{
+		New:      func() Environment { rec = &recorder{}; return rec },
+		Layout:   vm.Layout{Input: []int{1}, Output: []int{5}},
+		Episodes: 2,
+		Steps:    10,
+		Early:    0.5,
+	}
+	r := task.Evaluate(m, g)
+	if len(rec.actions) != 3 || rec.actions[0] != 1 || rec.actions[2] != 3 {
+		t.Error("Expected actions [1 2 3], got", rec.actions)
+	}
+	if r.Error != 2*(3+7*0.5) || len(r.Errors) != 2 {
+		t.Error("Expected error 3+3.5 per episode, got", r.Errors)
+	}
+	if r.Cost != 6 {
+		t.Error("Expected cost 6, got", r.Cost)
+	}
+}
+
+func TestPlants(t *testing.T) {
+	c := NewCartPole()
+	c.Reset(rand.New(rand.NewSource(1)))
+	steps := 0
+	for ; !c.Done() && steps < 1000; steps++ {
+		c.Act([]int{1}) // Always push right
+	}
+	if steps == 1000 || c.Reward() != -1 {
+		t.Error("Expected the pole to fall")
+	}
+
+	f := NewFirstOrderLag(10)
+	f.Reset(nil)
+	for i := 0; i < 100; i++ {
+		f.Act([]int{30}) // u = 3
+	}
+	if o := f.Observe(); o[1] != 60 {
+		t.Error("Expected y to settle at Gain*u = 6, got", o)
+	}
+
+	th := NewThermostat(20, 10)
+	th.Reset(nil)
+	for i := 0; i < 100; i++ {
+		th.Act([]int{1})
+	}
+	if th.T < 39 {
+		t.Error("Expected the heater to reach Outside + Heat/Loss = 40 degrees, got", th.T)
+	}
+	for i := 0; i < 100; i++ {
+		th.Act([]int{0})
+	}
+	if th.T > 11 {
+		t.Error("Expected the room to cool to the outside temperature, got", th.T)
+	}
+}
+
+func TestEvolveController(t *testing.T) {
+	task := &Task{
+		New:      func() Environment { return NewFirstOrderLag(10) },
+		Layout:   vm.Layout{Input: []int{1, 2}, Output: []int{3}},
+		Episodes: 1,
+		Steps:    30,
+		Seed:     1,
+	}
+	c := evolve.DefaultConfig()
+	c.PopulationSize = 50
+	c.Generations = 20
+	e := evolve.New(c, task)
+	e.Init()
+	initial := e.Best().Result.Error
+	best := e.Run()
+	if best.Result.Error >= initial {
+		t.Error("Expected the controller to improve from", initial, "got", best.Result.Error)
+	}
+}
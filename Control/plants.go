@@ -0,0 +1,179 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package control
+
+// Simulations of some common systems. States are kept as float64, and are converted to
+// integers by multiplying with Scale.
+
+import (
+	"math"
+	"math/rand"
+)
+
+// The classic cart-pole. The action is a push to the left if output 0 is negative, and to
+// the right otherwise. Observations are the cart position and velocity, and the pole
+// angle and angular velocity. The episode is done when the pole falls or the cart
+// leaves the track, which gives the reward -1.
+type CartPole struct {
+	Scale                    float64
+	X, XDot, Theta, ThetaDot float64
+	failed                   bool
+}
+
+// A first order lag, y' = (Gain*u - y)/Tau. The observations are the setpoint and y, and the
+// action is u. The reward is minus the distance to the setpoint.
+type FirstOrderLag struct {
+	Scale         float64
+	Gain, Tau, Dt float64
+	Setpoint, Y   float64
+	MaxU          float64 // u is limited to [-MaxU, MaxU], if not 0
+}
+
+// A room with a heater that is on or off. The temperature T changes as
+// T' = Loss*(Outside-T) + Heat*on. The heater is on if output 0 is positive. Observations
+// are the setpoint, the temperature and the outside temperature. The reward is minus
+// the distance to the setpoint.
+type Thermostat struct {
+	Scale                float64
+	Loss, Heat, Dt       float64
+	Setpoint, T, Outside float64
+}
+
+func scale(v, s float64) int {
+	return int(math.Round(v * s))
+}
+
+func NewCartPole() *CartPole {
+	return &CartPole{Scale: 100}
+}
+
+const (
+	cartGravity    = 9.8
+	cartMass       = 1.0
+	cartPoleMass   = 0.1
+	cartPoleLength = 0.5 // Half the length
+	cartForce      = 10.0
+	cartDt         = 0.02
+	cartMaxX       = 2.4
+	cartMaxTheta   = 12 * math.Pi / 180
+)
+
+func (c *CartPole) Reset(r *rand.Rand) {
+	*c = CartPole{Scale: c.Scale}
+	if r != nil {
+		c.X = r.Float64()*0.1 - 0.05
+		c.XDot = r.Float64()*0.1 - 0.05
+		c.Theta = r.Float64()*0.1 - 0.05
+		c.ThetaDot = r.Float64()*0.1 - 0.05
+	}
+}
+
+func (c *CartPole) Observe() []int {
+	return []int{scale(c.X, c.Scale), scale(c.XDot, c.Scale), scale(c.Theta, c.Scale), scale(c.ThetaDot, c.Scale)}
+}
+
+func (c *CartPole) Act(action []int) {
+	force := cartForce
+	if len(action) > 0 && action[0] < 0 {
+		force = -cartForce
+	}
+	total := cartMass + cartPoleMass
+	cos, sin := math.Cos(c.Theta), math.Sin(c.Theta)
+	temp := (force + cartPoleMass*cartPoleLength*c.ThetaDot*c.ThetaDot*sin) / total
+	thetaAcc := (cartGravity*sin - cos*temp) / (cartPoleLength * (4.0/3.0 - cartPoleMass*cos*cos/total))
+	xAcc := temp - cartPoleMass*cartPoleLength*thetaAcc*cos/total
+	c.X += cartDt * c.XDot
+	c.XDot += cartDt * xAcc
+	c.Theta += cartDt * c.ThetaDot
+	c.ThetaDot += cartDt * thetaAcc
+	c.failed = math.Abs(c.X) > cartMaxX || math.Abs(c.Theta) > cartMaxTheta
+}
+
+func (c *CartPole) Reward() float64 {
+	if c.failed {
+		return -1
+	}
+	return 0
+}
+
+func (c *CartPole) Done() bool {
+	return c.failed
+}
+
+func NewFirstOrderLag(setpoint float64) *FirstOrderLag {
+	return &FirstOrderLag{Scale: 10, Gain: 2, Tau: 5, Dt: 1, Setpoint: setpoint, MaxU: 100}
+}
+
+func (f *FirstOrderLag) Reset(r *rand.Rand) {
+	f.Y = 0
+}
+
+func (f *FirstOrderLag) Observe() []int {
+	return []int{scale(f.Setpoint, f.Scale), scale(f.Y, f.Scale)}
+}
+
+func (f *FirstOrderLag) Act(action []int) {
+	var u float64
+	if len(action) > 0 {
+		u = float64(action[0]) / f.Scale
+	}
+	if f.MaxU != 0 {
+		u = math.Max(-f.MaxU, math.Min(f.MaxU, u))
+	}
+	f.Y += f.Dt * (f.Gain*u - f.Y) / f.Tau
+}
+
+func (f *FirstOrderLag) Reward() float64 {
+	return -math.Abs(f.Setpoint - f.Y)
+}
+
+func (f *FirstOrderLag) Done() bool {
+	return false
+}
+
+func NewThermostat(setpoint, outside float64) *Thermostat {
+	return &Thermostat{Scale: 10, Loss: 0.1, Heat: 3, Dt: 1, Setpoint: setpoint, T: outside, Outside: outside}
+}
+
+// The initial temperature is the outside temperature, with a random deviation of up to 2 degrees
+func (t *Thermostat) Reset(r *rand.Rand) {
+	t.T = t.Outside
+	if r != nil {
+		t.T += r.Float64()*4 - 2
+	}
+}
+
+func (t *Thermostat) Observe() []int {
+	return []int{scale(t.Setpoint, t.Scale), scale(t.T, t.Scale), scale(t.Outside, t.Scale)}
+}
+
+func (t *Thermostat) Act(action []int) {
+	var heat float64
+	if len(action) > 0 && action[0] > 0 {
+		heat = t.Heat
+	}
+	t.T += t.Dt * (t.Loss*(t.Outside-t.T) + heat)
+}
+
+func (t *Thermostat) Reward() float64 {
+	return -math.Abs(t.Setpoint - t.T)
+}
+
+func (t *Thermostat) Done() bool {
+	return false
+}
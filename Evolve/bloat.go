@@ -0,0 +1,162 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// Bloat control. Programs tend to grow without improving the fitness, and there are
+// several ways to counter it. They can be combined, and the effect is seen in the
+// MeanLength of the Stats.
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"math"
+)
+
+type Bloat struct {
+	MaxLength int     // Children with more instructions are replaced by a copy of the first parent. 0 is no limit.
+	Parsimony bool    // Lexicographic parsimony: of two individuals with the same fitness, the shorter is better
+	Tarpeian  float64 // Probability that a child longer than the population mean is given the worst fitness, without evaluation
+	Covariant bool    // Covariant parsimony pressure: the fitness is adjusted with a length coefficient computed every generation
+}
+
+func length(ind *Individual) int {
+	return len(ind.Genome) / vm.InstructionSize
+}
+
+func meanLength(pop []*Individual) float64 {
+	var sum float64
+	for _, ind := range pop {
+		sum += float64(length(ind))
+	}
+	return sum / float64(len(pop))
+}
+
+// Restore the first parent if the child is too long
+func (e *Engine) limitLength(child, parent *Individual) {
+	if e.Config.Bloat.MaxLength == 0 || length(child) <= e.Config.Bloat.MaxLength {
+		return
+	}
+	child.Genome = parent.Genome
+	child.Rates = parent.Rates
+	child.Parents = []uint64{parent.Id}
+	child.Operator = 0
+	child.parentFitness = parent.Result.Fitness
+}
+
+// The Tarpeian method. Returns the children that shall not be evaluated.
+func (e *Engine) tarpeian(children []*Individual) map[*Individual]bool {
+	if e.Config.Bloat.Tarpeian == 0 || len(e.Population) == 0 {
+		return nil
+	}
+	mean := meanLength(e.Population)
+	killed := make(map[*Individual]bool)
+	for _, ind := range children {
+		if float64(length(ind)) > mean && e.rng.Float64() < e.Config.Bloat.Tarpeian {
+			killed[ind] = true
+		}
+	}
+	return killed
+}
+
+// Give the killed individuals the worst result of the generation, and mark them with
+// OpRejected. Every part of the result is the worst of any evaluated individual, so that
+// killed individuals are also worst in the objectives of Pareto selection and in the
+// test cases of lexicase.
+func (e *Engine) punish(killed map[*Individual]bool, list []*Individual) {
+	if len(killed) == 0 {
+		return
+	}
+	var worst fitness.Result
+	first := true
+	for _, pop := range [][]*Individual{list, e.Population} {
+		for _, ind := range pop {
+			if killed[ind] {
+				continue
+			}
+			r := ind.Result
+			if first {
+				worst = fitness.Result{Fitness: r.Fitness, Error: r.Error, Errors: append([]float64(nil), r.Errors...), Penalties: r.Penalties, Cost: r.Cost}
+				first = false
+				continue
+			}
+			worst.Fitness = math.Max(worst.Fitness, r.Fitness)
+			worst.Error = math.Max(worst.Error, r.Error)
+			if r.Penalties > worst.Penalties {
+				worst.Penalties = r.Penalties
+			}
+			if r.Cost > worst.Cost {
+				worst.Cost = r.Cost
+			}
+			for i := range worst.Errors {
+				if i < len(r.Errors) {
+					worst.Errors[i] = math.Max(worst.Errors[i], r.Errors[i])
+				}
+			}
+		}
+	}
+	for ind := range killed {
+		ind.Result = worst
+		ind.Result.Errors = append([]float64(nil), worst.Errors...)
+		ind.Fitness = worst.Fitness
+		ind.Operator |= OpRejected
+	}
+}
+
+// The coefficient c = Cov(l,f)/Var(l), for length l and fitness f. Subtracting c*l from
+// the fitness removes the correlation between length and fitness in the population,
+// so that programs will not grow only because longer programs are better.
+func parsimonyCoefficient(pop []*Individual) float64 {
+	n := float64(len(pop))
+	var meanL, meanF float64
+	for _, ind := range pop {
+		meanL += float64(length(ind))
+		meanF += ind.Fitness
+	}
+	meanL /= n
+	meanF /= n
+	var cov, variance float64
+	for _, ind := range pop {
+		dl := float64(length(ind)) - meanL
+		cov += dl * (ind.Fitness - meanF)
+		variance += dl * dl
+	}
+	if variance == 0 {
+		return 0
+	}
+	return cov / variance
+}
+
+// Adjust the fitness with covariant parsimony pressure
+func (e *Engine) applyParsimony() {
+	if !e.Config.Bloat.Covariant || len(e.Population) == 0 {
+		return
+	}
+	c := parsimonyCoefficient(e.Population)
+	e.parsimony = c
+	for _, ind := range e.Population {
+		ind.Fitness -= c * float64(length(ind))
+	}
+}
+
+// Compare on fitness, and on length if lexicographic parsimony is used
+func (e *Engine) less(a, b *Individual) bool {
+	if a.Fitness != b.Fitness || !e.Config.Bloat.Parsimony {
+		return a.Fitness < b.Fitness
+	}
+	return length(a) < length(b)
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"math"
+	"testing"
+)
+
+func individualOfLength(n int, f float64) *Individual {
+	return &Individual{Genome: make([]byte, n*vm.InstructionSize), Result: fitness.Result{Fitness: f}, Fitness: f}
+}
+
+func TestParsimonyCoefficient(t *testing.T) {
+	// Fitness is 10 - 2*length, so the coefficient shall be -2
+	var pop []*Individual
+	for l := 1; l < 5; l++ {
+		pop = append(pop, individualOfLength(l, 10-2*float64(l)))
+	}
+	if c := parsimonyCoefficient(pop); math.Abs(c+2) > 1e-9 {
+		t.Error("Expected coefficient -2, got", c)
+	}
+	// Adjusted fitness does not depend on length
+	e := New(DefaultConfig(), store42)
+	e.Config.Bloat.Covariant = true
+	e.Population = pop
+	e.applyParsimony()
+	for _, ind := range pop {
+		if ind.Fitness != 10 {
+			t.Error("Expected adjusted fitness 10, got", ind.Fitness)
+		}
+	}
+	if s := e.Stats(); s.Parsimony != -2 {
+		t.Error("Expected coefficient in stats, got", s.Parsimony)
+	}
+	pop = []*Individual{individualOfLength(3, 1), individualOfLength(3, 2)}
+	if c := parsimonyCoefficient(pop); c != 0 {
+		t.Error("Expected coefficient 0 without length variance, got", c)
+	}
+}
+
+func TestLexicographicParsimony(t *testing.T) {
+	e := New(DefaultConfig(), store42)
+	e.Population = []*Individual{individualOfLength(5, 1), individualOfLength(2, 1), individualOfLength(9, 0)}
+	e.sort()
+	if length(e.Population[0]) != 9 || length(e.Population[1]) != 5 {
+		t.Error("Without parsimony, the order shall be fitness only")
+	}
+	e.Config.Bloat.Parsimony = true
+	e.sort()
+	if length(e.Population[0]) != 9 || length(e.Population[1]) != 2 {
+		t.Error("Expected the shorter of equal fitness first")
+	}
+}
+
+func bloatConfig() Config {
+	c := DefaultConfig()
+	c.PopulationSize = 30
+	c.Generations = 20
+	return c
+}
+
+func growing(e *Engine) {
+	e.Mutation = vm.Pipeline{&vm.StructuralMutation{Insert: 0.5, InsertNoop: 0.5}, vm.BitMutation{Prob: 0.01}}
+}
+
+func TestMaxLength(t *testing.T) {
+	c := bloatConfig()
+	c.Bloat.MaxLength = 12
+	e := New(c, store42)
+	growing(e)
+	e.Run()
+	for _, ind := range e.Population {
+		if length(ind) > 12 {
+			t.Error("Expected at most 12 instructions, got", length(ind))
+		}
+	}
+}
+
+func TestTarpeian(t *testing.T) {
+	c := bloatConfig()
+	c.Bloat.Tarpeian = 1
+	e := New(c, store42)
+	growing(e)
+	e.Init()
+	mean := meanLength(e.Population)
+	worst := e.Population[len(e.Population)-1].Fitness
+	children := e.breedChildren(20)
+	e.evaluateChildren(children)
+	for _, ind := range children {
+		if float64(length(ind)) > mean && ind.Fitness < worst {
+			t.Error("Expected long child to get the worst fitness", worst, "got", ind.Fitness)
+		}
+		if rejected := ind.Operator&OpRejected != 0; rejected != (float64(length(ind)) > mean) {
+			t.Error("Expected only long children to be marked as rejected, got", ind.Operator, "for length", length(ind))
+		}
+	}
+
+	// The population is never rejected when it is evaluated again
+	for i := 0; i < 3; i++ {
+		e.Step()
+	}
+	e.SetObjective(store42)
+	long := 0
+	for _, ind := range e.Population {
+		if float64(length(ind)) > meanLength(e.Population) {
+			long++
+		}
+		if ind.Result.Fitness != store42.Evaluate(e.VM(), ind.Genome).Fitness {
+			t.Error("Expected the population to be evaluated, got", ind.Result)
+		}
+	}
+	if long == 0 {
+		t.Error("Expected programs longer than the mean")
+	}
+
+	// Bloat is reduced
+	free := New(bloatConfig(), store42)
+	growing(free)
+	free.Run()
+	e = New(c, store42)
+	growing(e)
+	e.Run()
+	if e.Stats().MeanLength >= free.Stats().MeanLength {
+		t.Error("Expected shorter programs with Tarpeian, got", e.Stats().MeanLength, "and", free.Stats().MeanLength)
+	}
+}
+
+// Individuals rejected by the Tarpeian method shall not be on the first Pareto front
+func TestTarpeianPareto(t *testing.T) {
+	c := bloatConfig()
+	c.Bloat.Tarpeian = 1
+	e := New(c, store42)
+	e.Selector = Pareto{}
+	growing(e)
+	e.Init()
+	mean := meanLength(e.Population)
+	children := e.breedChildren(30)
+	e.evaluateChildren(children)
+	var worstError float64
+	killed := make(map[*Individual]bool)
+	for _, ind := range append(children, e.Population...) {
+		if float64(length(ind)) > mean && !contains(e.Population, ind) {
+			killed[ind] = true
+		} else {
+			worstError = math.Max(worstError, ind.Result.Error)
+		}
+	}
+	if len(killed) == 0 {
+		t.Fatal("Expected some long children")
+	}
+	for ind := range killed {
+		if ind.Result.Error != worstError || ind.Result.Penalties == 0 && ind.Result.Cost == 0 {
+			t.Error("Expected the worst objectives for a rejected child, got", ind.Result)
+		}
+	}
+	for _, ind := range Front(append(children, e.Population...)) {
+		if killed[ind] {
+			t.Error("Rejected child on the first front:", ind.Result, length(ind))
+		}
+	}
+}
+
+func contains(list []*Individual, ind *Individual) bool {
+	for _, i := range list {
+		if i == ind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// Checkpoints contain the complete state of an engine, so that a run can be resumed
+// and continue exactly as if it had not been stopped. The objective, selector and
+// mutation operator are not saved, and have to be set up the same way after Resume.
+// The subroutine library of the virtual machine is saved, as the file it was loaded
+// from may have changed. The islands of an island model are saved together, with the
+// state of the migration.
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+)
+
+// A random source for math/rand that can be saved
+type source struct {
+	pcg *rand.PCG
+}
+
+// The file format. Genomes are saved in their MarshalBinary form.
+type checkpoint struct {
+	Config      Config
+	Generation  int
+	NextId      uint64
+	Random      []byte
+	Population  []savedIndividual
+	HallOfFame  []savedIndividual
+	Novelty     *Novelty
+	Novelties   [][]float64 // Novelty archive
+	Rule        *vm.SuccessRule
+	Library     []byte // JSON of the subroutine library, if any
+	LibInit     float64
+	ArchiveSize int64 // Size of the lineage archive, where a resumed run continues it
+}
+
+// The file format of an island model. No field has the same name as in checkpoint, so
+// that an engine can not be resumed from an island checkpoint, or the other way around.
+type islandsCheckpoint struct {
+	Islands         []checkpoint
+	Topology        Topology
+	Interval        int
+	Migrants        int
+	Migration       []byte // The random source of the migration
+	Checkpoint      string
+	CheckpointEvery int
+}
+
+// Individual, including the fields used by Pareto selection
+type savedIndividual struct {
+	Individual
+	Rank     int
+	Crowding float64
+}
+
+func newSource(seed int64) *source {
+	return &source{pcg: rand.NewPCG(uint64(seed), 0)}
+}
+
+func (s *source) Int63() int64 {
+	return int64(s.pcg.Uint64() >> 1)
+}
+
+func (s *source) Uint64() uint64 {
+	return s.pcg.Uint64()
+}
+
+func (s *source) Seed(seed int64) {
+	s.pcg.Seed(uint64(seed), 0)
+}
+
+func save(list []*Individual) (ret []savedIndividual) {
+	for _, ind := range list {
+		ret = append(ret, savedIndividual{Individual: *ind, Rank: ind.rank, Crowding: ind.crowding})
+	}
+	return
+}
+
+// Individuals that are both in the population and the hall of fame are restored as the same
+func restore(list []savedIndividual, known map[uint64]*Individual) (ret []*Individual) {
+	for _, s := range list {
+		ind, ok := known[s.Id]
+		if !ok {
+			ind = new(Individual)
+			*ind = s.Individual
+			ind.rank, ind.crowding = s.Rank, s.Crowding
+			known[s.Id] = ind
+		}
+		ret = append(ret, ind)
+	}
+	return
+}
+
+// Write a gzip compressed checkpoint. The index of the lineage archive is written first,
+// so that the archive is complete up to the checkpoint if the run crashes later.
+func (e *Engine) Save(w io.Writer) error {
+	c, err := e.snapshot()
+	if err != nil {
+		return err
+	}
+	return encode(w, c)
+}
+
+func (e *Engine) snapshot() (*checkpoint, error) {
+	if err := e.flushArchive(); err != nil {
+		return nil, err
+	}
+	random, err := e.source.pcg.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	c := &checkpoint{
+		Config:      e.Config,
+		Generation:  e.Generation,
+		NextId:      e.nextId,
+		Random:      random,
+		Population:  save(e.Population),
+		HallOfFame:  save(e.HallOfFame),
+		Novelty:     e.Novelty,
+		Novelties:   e.novelties,
+		Rule:        e.rule,
+		ArchiveSize: e.archiveSize,
+	}
+	if l := e.vm.Library(); l != nil {
+		if c.Library, err = json.Marshal(l); err != nil {
+			return nil, err
+		}
+		c.LibInit = l.Init
+	}
+	return c, nil
+}
+
+// Gzip compressed gob
+func encode(w io.Writer, v interface{}) error {
+	zw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(zw).Encode(v); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func decode(r io.Reader, v interface{}) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(zr).Decode(v)
+}
+
+// Save to a file. The previous checkpoint is replaced only when the new is complete.
+func (e *Engine) SaveFile(name string) error {
+	return saveFile(name, e.Save)
+}
+
+func saveFile(name string, save func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	err = save(f)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Create an engine from a checkpoint. The selector, mutation operator and OnGeneration
+// callback are not saved, and have to be set again.
+func Resume(r io.Reader, objective fitness.Objective) (*Engine, error) {
+	var c checkpoint
+	if err := decode(r, &c); err != nil {
+		return nil, err
+	}
+	return c.engine(objective)
+}
+
+func (c *checkpoint) engine(objective fitness.Objective) (*Engine, error) {
+	e := New(c.Config, objective)
+	if err := e.source.pcg.UnmarshalBinary(c.Random); err != nil {
+		return nil, err
+	}
+	e.Generation = c.Generation
+	e.nextId = c.NextId
+	e.archiveSize = c.ArchiveSize
+	known := make(map[uint64]*Individual)
+	e.Population = restore(c.Population, known)
+	e.HallOfFame = restore(c.HallOfFame, known)
+	e.Novelty = c.Novelty
+	e.novelties = c.Novelties
+	if c.Rule != nil {
+		e.rule = c.Rule
+	}
+	if c.Library != nil {
+		l, err := vm.UnmarshalLibrary(c.Library)
+		if err != nil {
+			return nil, err
+		}
+		l.Init = c.LibInit
+		e.vm.SetLibrary(l)
+	}
+	e.speciate()
+	return e, nil
+}
+
+func ResumeFile(name string, objective fitness.Objective) (*Engine, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Resume(f, objective)
+}
+
+// Write a checkpoint of all islands. The indexes of the lineage archives are written first.
+func (is *Islands) Save(w io.Writer) error {
+	migration, err := is.source.pcg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	c := islandsCheckpoint{
+		Topology:        is.Topology,
+		Interval:        is.Interval,
+		Migrants:        is.Migrants,
+		Migration:       migration,
+		Checkpoint:      is.Checkpoint,
+		CheckpointEvery: is.CheckpointEvery,
+	}
+	for _, e := range is.Engines {
+		ec, err := e.snapshot()
+		if err != nil {
+			return err
+		}
+		c.Islands = append(c.Islands, *ec)
+	}
+	return encode(w, &c)
+}
+
+func (is *Islands) SaveFile(name string) error {
+	return saveFile(name, is.Save)
+}
+
+// Create an island model from a checkpoint. The objective is used by all islands.
+func ResumeIslands(r io.Reader, objective fitness.Objective) (*Islands, error) {
+	var c islandsCheckpoint
+	if err := decode(r, &c); err != nil {
+		return nil, err
+	}
+	if len(c.Islands) == 0 {
+		return nil, errors.New("evolve: checkpoint without islands")
+	}
+	src := newSource(0)
+	if err := src.pcg.UnmarshalBinary(c.Migration); err != nil {
+		return nil, err
+	}
+	is := &Islands{
+		Topology:        c.Topology,
+		Interval:        c.Interval,
+		Migrants:        c.Migrants,
+		Checkpoint:      c.Checkpoint,
+		CheckpointEvery: c.CheckpointEvery,
+	}
+	is.setSource(src)
+	for i := range c.Islands {
+		e, err := c.Islands[i].engine(objective)
+		if err != nil {
+			return nil, err
+		}
+		is.Engines = append(is.Engines, e)
+	}
+	return is, nil
+}
+
+func ResumeIslandsFile(name string, objective fitness.Objective) (*Islands, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ResumeIslands(f, objective)
+}
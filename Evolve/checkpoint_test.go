@@ -0,0 +1,176 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/VirtualMachine"
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func checkpointEngine(c Config, pareto bool) *Engine {
+	e := New(c, store42)
+	e.Mutation = vm.Pipeline{&vm.StructuralMutation{Insert: 0.1, Delete: 0.1}, &vm.SelfAdaptive{Initial: vm.Rates{Bit: 0.01, Structural: 1}}}
+	if pareto {
+		e.Selector = Pareto{}
+	}
+	return e
+}
+
+func samePopulation(t *testing.T, a, b []*Individual) {
+	if len(a) != len(b) {
+		t.Fatal("Population sizes differ", len(a), len(b))
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i], b[i]) {
+			t.Fatal("Individual", i, "differs:", a[i], b[i])
+		}
+	}
+}
+
+// A resumed run shall give exactly the same result as a run that was never stopped
+func TestResume(t *testing.T) {
+	for _, pareto := range []bool{false, true} {
+		c := DefaultConfig()
+		c.PopulationSize = 20
+		c.Generations = 10
+		c.HallOfFame = 5
+		c.SuccessRule = 0.02
+		full := checkpointEngine(c, pareto)
+		full.Run()
+
+		c.Generations = 5
+		first := checkpointEngine(c, pareto)
+		first.Run()
+		var buf bytes.Buffer
+		if err := first.Save(&buf); err != nil {
+			t.Fatal("Save returned", err)
+		}
+		resumed, err := Resume(&buf, store42)
+		if err != nil {
+			t.Fatal("Resume returned", err)
+		}
+		samePopulation(t, first.Population, resumed.Population)
+		resumed.Mutation = first.Mutation
+		resumed.Selector = first.Selector
+		resumed.Config.Generations = 10
+		resumed.Run()
+		samePopulation(t, full.Population, resumed.Population)
+		samePopulation(t, full.HallOfFame, resumed.HallOfFame)
+		if *resumed.rule != *full.rule {
+			t.Error("Expected the success rule", *full.rule, "got", *resumed.rule)
+		}
+		if len(resumed.HallOfFame) != 5 {
+			t.Error("Expected a hall of fame of 5, got", len(resumed.HallOfFame))
+		}
+	}
+}
+
+// The novelty settings and archive are part of the checkpoint
+func TestResumeNovelty(t *testing.T) {
+	c := noveltyConfig()
+	novelty := func(c Config) *Engine {
+		e := New(c, store42)
+		e.Novelty = &Novelty{Layout: vm.Layout{Input: []int{1}, Output: []int{2}}, Probes: [][]int{{0}, {7}}, Weight: 0.5, MaxSize: 30}
+		return e
+	}
+	full := novelty(c)
+	full.Run()
+
+	c.Generations = 5
+	first := novelty(c)
+	first.Run()
+	var buf bytes.Buffer
+	if err := first.Save(&buf); err != nil {
+		t.Fatal("Save returned", err)
+	}
+	resumed, err := Resume(&buf, store42)
+	if err != nil {
+		t.Fatal("Resume returned", err)
+	}
+	if !reflect.DeepEqual(resumed.Novelty, first.Novelty) || resumed.NoveltyArchiveSize() != first.NoveltyArchiveSize() {
+		t.Fatal("Expected the novelty settings", first.Novelty, "got", resumed.Novelty)
+	}
+	resumed.Config.Generations = 10
+	resumed.Run()
+	samePopulation(t, full.Population, resumed.Population)
+}
+
+func TestPeriodicCheckpoint(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 10
+	c.Generations = 6
+	c.Checkpoint = filepath.Join(t.TempDir(), "run.ckpt")
+	c.CheckpointEvery = 4
+	New(c, store42).Run()
+	e, err := ResumeFile(c.Checkpoint, store42)
+	if err != nil {
+		t.Fatal("ResumeFile returned", err)
+	}
+	if e.Generation != 4 {
+		t.Error("Expected a checkpoint from generation 4, got", e.Generation)
+	}
+}
+
+// The library is part of the checkpoint, including the usage counts
+func TestResumeLibrary(t *testing.T) {
+	library := func() *vm.Library {
+		l := &vm.Library{Init: 1}
+		e := New(DefaultConfig(), store42)
+		p := e.VM().RandomProgram(3, rand.New(rand.NewSource(1)))
+		l.Add(p, "test", 0)
+		return l
+	}
+	engine := func(c Config) *Engine {
+		e := New(c, store42)
+		e.VM().SetLibrary(library())
+		e.Mutation = vm.Pipeline{vm.LibraryInsert{Prob: 0.1, MaxLength: 30}, vm.BitMutation{Prob: 0.01}}
+		return e
+	}
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 10
+	full := engine(c)
+	full.Run()
+
+	c.Generations = 5
+	first := engine(c)
+	first.Run()
+	var buf bytes.Buffer
+	if err := first.Save(&buf); err != nil {
+		t.Fatal("Save returned", err)
+	}
+	resumed, err := Resume(&buf, store42)
+	if err != nil {
+		t.Fatal("Resume returned", err)
+	}
+	l := resumed.VM().Library()
+	if l == nil || l.Init != 1 || l.Len() != 1 || l.Subroutines[0].Usage != first.VM().Library().Subroutines[0].Usage {
+		t.Fatal("Expected the library of the first run, got", l)
+	}
+	resumed.Mutation = first.Mutation
+	resumed.Config.Generations = 10
+	resumed.Run()
+	samePopulation(t, full.Population, resumed.Population)
+	if l.Subroutines[0].Usage != full.VM().Library().Subroutines[0].Usage {
+		t.Error("Expected usage", full.VM().Library().Subroutines[0].Usage, "got", l.Subroutines[0].Usage)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// A curriculum is a list of problems of increasing difficulty. The population is
+// evolved on one problem at a time, and is carried forward to the next when the
+// first is good enough. Solutions are added to the subroutine library, if any, so
+// that later stages can reuse them.
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+)
+
+type Stage struct {
+	Name        string
+	Objective   fitness.Objective
+	Threshold   float64 // Advance to the next stage when the best fitness is at most this
+	Generations int     // Maximum number of generations in the stage
+}
+
+type StageStats struct {
+	Name        string
+	Generations int // Generations used in the stage
+	Best        float64
+	MeanLength  float64
+	Solved      bool   // The threshold was reached
+	Subroutine  uint64 // Id in the library of the solution, 0 if none was added
+}
+
+type Curriculum struct {
+	Stages  []Stage
+	Library *vm.Library // Optional, shared by all stages
+	Stats   []StageStats
+}
+
+// Evolve on every stage in turn, starting from the current population of e. Stops after
+// the first stage that does not reach the threshold. Returns true if all stages were solved.
+func (c *Curriculum) Run(e *Engine) bool {
+	if c.Library != nil {
+		e.vm.SetLibrary(c.Library)
+	}
+	c.Stats = nil
+	for _, stage := range c.Stages {
+		e.Config.Problem = stage.Name
+		if e.Population == nil {
+			e.Objective = stage.Objective
+			e.Init()
+		} else {
+			e.SetObjective(stage.Objective)
+		}
+		start := e.Generation
+		for e.Best().Result.Fitness > stage.Threshold && e.Generation-start < stage.Generations {
+			e.Step()
+		}
+		best := e.Best()
+		s := StageStats{
+			Name:        stage.Name,
+			Generations: e.Generation - start,
+			Best:        best.Result.Fitness,
+			MeanLength:  meanLength(e.Population),
+			Solved:      best.Result.Fitness <= stage.Threshold,
+		}
+		if s.Solved && c.Library != nil {
+			p := e.vm.NewProgram()
+			p.UnmarshalBinary(best.Genome)
+			s.Subroutine = c.Library.Add(p, stage.Name, s.Best).Id
+		}
+		c.Stats = append(c.Stats, s)
+		if !s.Solved {
+			return false
+		}
+	}
+	return true
+}
+
+// Change the objective, and evaluate the population again. The hall of fame is cleared,
+// as the old fitness values can't be compared with the new.
+func (e *Engine) SetObjective(objective fitness.Objective) {
+	e.Objective = objective
+	e.HallOfFame = nil
+	e.evaluate(e.Population)
+	if s, ok := e.Selector.(survivor); ok {
+		e.Population = s.Survive(e.Population, len(e.Population))
+	}
+	e.report()
+}
@@ -0,0 +1,67 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"testing"
+)
+
+func TestCurriculum(t *testing.T) {
+	store := func(values ...int) fitness.Objective {
+		c := fitness.Case{Expected: values}
+		l := vm.Layout{}
+		for i := range values {
+			l.Output = append(l.Output, i+1)
+		}
+		return fitness.NewHarness(&fitness.Table{IO: l, List: []fitness.Case{c}})
+	}
+	cur := &Curriculum{
+		Stages: []Stage{
+			{Name: "one", Objective: store(5), Threshold: 0, Generations: 100},
+			{Name: "two", Objective: store(5, 7), Threshold: 10, Generations: 100},
+			{Name: "impossible", Objective: store(5, 7, 9, 11, 13, 15, 17, 19, 21, 23, 25, 27, 29, 31, 33), Threshold: 0, Generations: 3},
+			{Name: "never", Objective: store(1), Generations: 10},
+		},
+		Library: &vm.Library{},
+	}
+	c := DefaultConfig()
+	c.PopulationSize = 50
+	e := New(c, nil)
+	if cur.Run(e) {
+		t.Error("Expected the curriculum to stop")
+	}
+	if len(cur.Stats) != 3 {
+		t.Fatal("Expected 3 stages to be run, got", cur.Stats)
+	}
+	for i, s := range cur.Stats[:2] {
+		if !s.Solved || s.Best > cur.Stages[i].Threshold || s.Subroutine != uint64(i+1) {
+			t.Error("Expected stage", s.Name, "to be solved and added to the library, got", s)
+		}
+	}
+	if s := cur.Stats[2]; s.Solved || s.Generations != 3 || s.Subroutine != 0 {
+		t.Error("Expected the last stage to fail after 3 generations, got", s)
+	}
+	if cur.Library.Len() != 2 || cur.Library.Subroutines[1].Problem != "two" {
+		t.Error("Expected the solutions in the library, got", cur.Library.Subroutines)
+	}
+	if e.Generation != cur.Stats[0].Generations+cur.Stats[1].Generations+3 {
+		t.Error("Expected the generations of all stages, got", e.Generation)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// A generational evolutionary engine. Programs are kept in serialized form, as genomes,
+// and are decoded by the virtual machine when they are mutated or evaluated.
+package evolve
+
+import (
+	"Aldcran/Archive"
+	"Aldcran/Fitness"
+	"Aldcran/MergePrograms"
+	"Aldcran/VirtualMachine"
+	"context"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+type Config struct {
+	VM               vm.Config
+	PopulationSize   int
+	Generations      int
+	InitialLength    int     // Number of instructions in the initial random programs
+	MergeProb        float64 // Probability that a child is a merge of two parents, otherwise it is a copy of one
+	Elitism          int     // Number of best individuals copied unchanged to the next generation
+	Seed             int64
+	HallOfFame       int    // Number of best individuals ever seen that are remembered
+	FrontFile        string // If set, the Pareto front is written to this file at the end of Run
+	Checkpoint       string // If set, a checkpoint is written to this file every CheckpointEvery generation
+	CheckpointEvery  int
+	Problem          string // Name of the problem, only used to identify a run
+	SpeciesThreshold int    // Maximum edit distance, in instructions, within a species. 0 disables speciation.
+	Bloat            Bloat
+	Library          string  // File with a subroutine library. Only used by the command line, the library is loaded into the VM.
+	Archive          string  // If set, every individual is recorded in this archive file
+	SuccessRule      float64 // Initial rate of an extra bit mutation, adapted with the 1/5th success rule. 0 disables.
+}
+
+type Individual struct {
+	Id        uint64
+	Genome    []byte    // The program, serialized with MarshalBinary
+	Rates     *vm.Rates // Only used with self adaptive mutation
+	Parents   []uint64
+	Result    fitness.Result
+	Fitness   float64   // Lower is better. Normally the same as Result.Fitness.
+	Behaviour []float64 // Fingerprint used by novelty search
+	Operator  Operator  // The operators that created the individual
+	Delta     float64   // Fitness change from the best parent, negative is an improvement
+	rank      int       // Pareto front, used by Pareto selection
+	crowding  float64   // Crowding distance, used by Pareto selection
+
+	parentFitness float64 // Result.Fitness of the best parent, until the child is evaluated
+}
+
+// Summary of a generation
+type Stats struct {
+	Generation        int
+	Best, Mean, Worst float64 // Task fitness of the evaluated individuals
+	MeanLength        float64 // Mean number of instructions
+	Diversity         float64 // Mean edit distance between programs, in instructions
+	Species           int     // Number of species, if speciation is used
+	Parsimony         float64 // The coefficient of covariant parsimony pressure
+	SuccessRate       float64 // The bit mutation rate of the 1/5th success rule, if used
+}
+
+type Engine struct {
+	Config       Config
+	Objective    fitness.Objective
+	Selector     Selector
+	Mutation     vm.Mutator    // Applied to every child that is not an elite
+	OnGeneration func(s Stats) // Called after every generation, including the initial population
+	Population   []*Individual // Sorted on fitness, best first
+	Generation   int
+	HallOfFame   []*Individual   // Sorted on Result.Fitness, best first
+	Species      []*Species      // Only used with speciation
+	Novelty      *Novelty        // If set, novelty is part of the fitness
+	novelties    [][]float64     // The novelty archive, with behaviours of novel individuals
+	noveltyKeys  map[string]bool // Keys of the behaviours in novelties
+	parsimony    float64         // Covariant parsimony coefficient of the current generation
+	rng          *rand.Rand
+	source       *source
+	vm           *vm.VirtualMachine // Used for all decoding and evaluation
+	rule         *vm.SuccessRule    // Only used if Config.SuccessRule is set
+	nextId       uint64
+	lineage      *archive.Writer // Open lineage archive, if Config.Archive is set
+	archiveSize  int64           // Size of the lineage archive when its index was last written
+	err          error           // First error from the lineage archive
+}
+
+func DefaultConfig() Config {
+	return Config{
+		VM:             vm.Config{Width: 16, MemorySize: 16},
+		PopulationSize: 100,
+		Generations:    100,
+		InitialLength:  10,
+		MergeProb:      0.5,
+		Elitism:        1,
+		Seed:           1,
+	}
+}
+
+// The default selection is a tournament of size 2, and the default mutation
+// is bit mutation of the serialized program.
+func New(c Config, objective fitness.Objective) *Engine {
+	src := newSource(c.Seed)
+	e := &Engine{
+		Config:    c,
+		Objective: objective,
+		Selector:  Tournament{Size: 2},
+		Mutation:  vm.BitMutation{Prob: 0.01},
+		rng:       rand.New(src),
+		source:    src,
+		vm:        vm.NewFromConfig(c.VM),
+	}
+	if c.SuccessRule > 0 {
+		e.rule = &vm.SuccessRule{Rate: c.SuccessRule}
+	}
+	return e
+}
+
+// Create and evaluate a random population
+func (e *Engine) Init() {
+	e.Population = nil
+	e.Generation = 0
+	for i := 0; i < e.Config.PopulationSize; i++ {
+		genome, _ := e.vm.RandomProgram(e.Config.InitialLength, e.rng).MarshalBinary()
+		e.Population = append(e.Population, &Individual{Id: e.newId(), Genome: genome})
+	}
+	e.evaluate(e.Population)
+	e.record(e.Population)
+	if s, ok := e.Selector.(survivor); ok {
+		e.Population = s.Survive(e.Population, len(e.Population))
+	}
+	e.report()
+}
+
+// Create the next generation
+func (e *Engine) Step() {
+	if s, ok := e.Selector.(survivor); ok {
+		// Survivors are chosen from both parents and children
+		children := e.breedChildren(e.Config.PopulationSize)
+		e.evaluateChildren(children)
+		setDelta(children)
+		e.adaptRate(children)
+		e.Population = s.Survive(append(e.Population, children...), e.Config.PopulationSize)
+		e.Generation++
+		e.record(children)
+		e.report()
+		return
+	}
+	next := make([]*Individual, 0, e.Config.PopulationSize)
+	for i := 0; i < e.Config.Elitism && i < len(e.Population); i++ {
+		next = append(next, e.Population[i])
+	}
+	children := e.breedChildren(e.Config.PopulationSize - len(next))
+	e.evaluateChildren(children)
+	setDelta(children)
+	e.adaptRate(children)
+	e.Population = append(next, children...)
+	e.Generation++
+	e.record(children)
+	e.report()
+}
+
+// Evolve until the configured number of generations, and return the best individual
+func (e *Engine) Run() *Individual {
+	return e.RunContext(context.Background())
+}
+
+// Same as Run, but stops after the current generation if ctx is done, or if the lineage
+// archive fails, see Err. The Pareto front is only written if the run is completed.
+func (e *Engine) RunContext(ctx context.Context) *Individual {
+	if e.Population == nil {
+		e.Init()
+	}
+	for e.Generation < e.Config.Generations {
+		if ctx.Err() != nil || e.err != nil {
+			e.CloseArchive()
+			return e.Best()
+		}
+		e.Step()
+	}
+	e.CloseArchive()
+	if e.Config.FrontFile != "" {
+		if err := e.WriteFront(e.Config.FrontFile); err != nil {
+			log.Println("Failed to write Pareto front:", err)
+		}
+	}
+	return e.Best()
+}
+
+// The individual with the best task fitness. The population is sorted on the adjusted
+// fitness, which includes novelty and parsimony, so the first one need not be the best.
+func (e *Engine) Best() (best *Individual) {
+	for _, ind := range e.Population {
+		if best == nil || ind.Result.Fitness < best.Result.Fitness {
+			best = ind
+		}
+	}
+	return
+}
+
+// The virtual machine used by the engine
+func (e *Engine) VM() *vm.VirtualMachine {
+	return e.vm
+}
+
+func (e *Engine) newId() uint64 {
+	e.nextId++
+	return e.nextId
+}
+
+// Create n children. With speciation, every species gets its quota of children, and
+// both parents are from the same species.
+func (e *Engine) breedChildren(n int) (children []*Individual) {
+	if e.Config.SpeciesThreshold == 0 {
+		for len(children) < n {
+			children = append(children, e.breed(e.Population))
+		}
+		return
+	}
+	e.assignQuotas(n)
+	for _, s := range e.Species {
+		for i := 0; i < s.Offspring; i++ {
+			children = append(children, e.breed(s.Members))
+		}
+	}
+	return
+}
+
+// Create a child with parents from pool, which is sorted on fitness
+func (e *Engine) breed(pool []*Individual) *Individual {
+	a := e.Selector.Select(pool, e.rng)
+	child := &Individual{Id: e.newId(), Genome: a.Genome, Rates: a.Rates, Parents: []uint64{a.Id}}
+	child.parentFitness = a.Result.Fitness
+	if e.rng.Float64() < e.Config.MergeProb {
+		b := e.Selector.Select(pool, e.rng)
+		child.Genome = merge.RandomMergeUnits(a.Genome, b.Genome, vm.InstructionSize, e.rng)
+		child.Rates = vm.InheritRates(a.Rates, b.Rates)
+		child.Parents = append(child.Parents, b.Id)
+		child.parentFitness = math.Min(a.Result.Fitness, b.Result.Fitness)
+		child.Operator = OpMerge
+	}
+	child.Operator |= e.mutate(child)
+	e.limitLength(child, a)
+	return child
+}
+
+// Apply the mutation operator to the genome, followed by the bit mutation of the success
+// rule if it is used. Returns the operators that changed the genome. The operators of a
+// pipeline are applied one by one, the same way as Pipeline.Apply, to find out which of
+// them made a change.
+func (e *Engine) mutate(ind *Individual) (op Operator) {
+	if e.Mutation == nil && e.rule == nil {
+		return 0
+	}
+	p := e.vm.NewProgram()
+	p.UnmarshalBinary(ind.Genome)
+	if ind.Rates != nil {
+		rates := *ind.Rates // The parent rates must not change
+		p.SetRates(&rates)
+	}
+	var apply func(m vm.Mutator)
+	apply = func(m vm.Mutator) {
+		if pl, ok := m.(vm.Pipeline); ok {
+			for _, sub := range pl {
+				apply(sub)
+			}
+		} else if m.Apply(p, e.rng) {
+			op |= operatorOf(m)
+		}
+	}
+	if e.Mutation != nil {
+		apply(e.Mutation)
+	}
+	if e.rule != nil {
+		apply(vm.BitMutation{Prob: float32(e.rule.Rate)})
+	}
+	ind.Rates = p.Rates() // Self adaptive rates are mutated even if the genome is not
+	if op != 0 {
+		ind.Genome, _ = p.MarshalBinary()
+	}
+	return op
+}
+
+// The 1/5th success rule. A mutated child is a success if it is better than its best parent.
+func (e *Engine) adaptRate(children []*Individual) {
+	if e.rule == nil {
+		return
+	}
+	for _, ind := range children {
+		if ind.Operator&OpRejected == 0 && ind.Operator&^OpMerge != 0 {
+			e.rule.Record(ind.Delta < 0)
+		}
+	}
+}
+
+func (e *Engine) evaluate(list []*Individual) {
+	for _, ind := range list {
+		e.vm.Reset()
+		ind.Result = e.Objective.Evaluate(e.vm, ind.Genome)
+		ind.Fitness = ind.Result.Fitness
+	}
+}
+
+// Evaluate new children. Only children can be rejected by the Tarpeian method.
+func (e *Engine) evaluateChildren(children []*Individual) {
+	killed := e.tarpeian(children)
+	var evaluated []*Individual
+	for _, ind := range children {
+		if !killed[ind] {
+			evaluated = append(evaluated, ind)
+		}
+	}
+	e.evaluate(evaluated)
+	e.punish(killed, children)
+}
+
+// Sort the population, update the hall of fame, call the callback and save a checkpoint if it is time
+func (e *Engine) report() {
+	for _, ind := range e.Population {
+		ind.Fitness = ind.Result.Fitness // Adjustments are computed again every generation
+	}
+	e.applyNovelty()
+	e.applyParsimony()
+	e.sort()
+	e.updateHallOfFame()
+	e.speciate()
+	if e.OnGeneration != nil {
+		e.OnGeneration(e.Stats())
+	}
+	if e.Config.Checkpoint != "" && e.Config.CheckpointEvery > 0 && e.Generation%e.Config.CheckpointEvery == 0 {
+		if err := e.SaveFile(e.Config.Checkpoint); err != nil {
+			log.Println("Failed to save checkpoint:", err)
+		}
+	}
+}
+
+func (e *Engine) updateHallOfFame() {
+	if e.Config.HallOfFame == 0 {
+		return
+	}
+	seen := make(map[uint64]bool)
+	var list []*Individual
+	for _, ind := range append(e.HallOfFame, e.Population...) {
+		if !seen[ind.Id] {
+			seen[ind.Id] = true
+			list = append(list, ind)
+		}
+	}
+	// Fitness may be adjusted by novelty or parsimony, which is only updated for the population
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Result.Fitness != b.Result.Fitness || !e.Config.Bloat.Parsimony {
+			return a.Result.Fitness < b.Result.Fitness
+		}
+		return length(a) < length(b)
+	})
+	if len(list) > e.Config.HallOfFame {
+		list = list[:e.Config.HallOfFame]
+	}
+	e.HallOfFame = list
+}
+
+func (e *Engine) sort() {
+	sort.SliceStable(e.Population, func(i, j int) bool {
+		return e.less(e.Population[i], e.Population[j])
+	})
+}
+
+func (e *Engine) Stats() (s Stats) {
+	s.Generation = e.Generation
+	if len(e.Population) == 0 {
+		return
+	}
+	n := 0
+	for _, ind := range e.Population {
+		if ind.Operator&OpRejected != 0 {
+			continue
+		}
+		f := ind.Result.Fitness
+		if n == 0 || f < s.Best {
+			s.Best = f
+		}
+		if n == 0 || f > s.Worst {
+			s.Worst = f
+		}
+		s.Mean += f
+		n++
+	}
+	if n > 0 {
+		s.Mean /= float64(n)
+	}
+	s.MeanLength = meanLength(e.Population)
+	s.Diversity = Diversity(e.Population)
+	s.Species = len(e.Species)
+	s.Parsimony = e.parsimony
+	if e.rule != nil {
+		s.SuccessRate = e.rule.Rate
+	}
+	return
+}
@@ -0,0 +1,134 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"testing"
+)
+
+// Find a program that stores 42 in memory cell 1
+var store42 = fitness.NewHarness(&fitness.Table{
+	IO:   vm.Layout{Output: []int{1}},
+	List: []fitness.Case{{Expected: []int{42}}},
+})
+
+func TestEvolve(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 50
+	c.Generations = 30
+	var stats []Stats
+	e := New(c, store42)
+	e.OnGeneration = func(s Stats) {
+		stats = append(stats, s)
+	}
+	best := e.Run()
+	if len(stats) != c.Generations+1 {
+		t.Fatal("Expected", c.Generations+1, "callbacks, got", len(stats))
+	}
+	for i := 1; i < len(stats); i++ {
+		if stats[i].Best > stats[i-1].Best {
+			t.Error("Best fitness got worse in generation", i, "with elitism")
+		}
+	}
+	if best.Result.Fitness >= stats[0].Best && stats[0].Best > 0 {
+		t.Error("No improvement from", stats[0].Best)
+	}
+	t.Log("Best fitness", best.Result.Fitness, "after", e.Generation, "generations")
+	if len(e.Population) != c.PopulationSize {
+		t.Error("Expected population size", c.PopulationSize, "got", len(e.Population))
+	}
+}
+
+// Best shall rank on the task fitness, not on the fitness adjusted by novelty or parsimony
+func TestBest(t *testing.T) {
+	var e Engine
+	if e.Best() != nil {
+		t.Error("Expected no best individual of an empty population")
+	}
+	e.Population = []*Individual{
+		{Id: 1, Fitness: 1, Result: fitness.Result{Fitness: 5}},
+		{Id: 2, Fitness: 2, Result: fitness.Result{Fitness: 3}},
+		{Id: 3, Fitness: 3, Result: fitness.Result{Fitness: 4}},
+	}
+	if best := e.Best(); best.Id != 2 {
+		t.Error("Expected individual 2, got", best.Id)
+	}
+	is := Islands{Engines: []*Engine{&e, {Population: []*Individual{{Id: 4, Fitness: 0, Result: fitness.Result{Fitness: 4}}}}}}
+	if best := is.Best(); best.Id != 2 {
+		t.Error("Expected individual 2 from the islands, got", best.Id)
+	}
+}
+
+// The same seed shall give the same result
+func TestEvolveDeterministic(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 10
+	a := New(c, store42).Run()
+	b := New(c, store42).Run()
+	if a.Id != b.Id || a.Fitness != b.Fitness || string(a.Genome) != string(b.Genome) {
+		t.Error("Expected identical runs")
+	}
+}
+
+func TestSuccessRule(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 20
+	c.SuccessRule = 0.05
+	e := New(c, store42)
+	var rates []float64
+	e.OnGeneration = func(s Stats) {
+		rates = append(rates, s.SuccessRate)
+	}
+	e.Run()
+	if rates[0] != 0.05 {
+		t.Error("Expected the initial rate 0.05, got", rates[0])
+	}
+	last := rates[len(rates)-1]
+	if last == 0.05 || last < 1e-5 || last > 1 {
+		t.Error("Expected an adapted rate within limits, got", rates)
+	}
+}
+
+// Self adaptive rates shall change even when they are too low to mutate the genome, and
+// an individual without rates shall get them
+func TestSelfAdaptiveRates(t *testing.T) {
+	e := New(DefaultConfig(), store42)
+	e.Mutation = &vm.SelfAdaptive{Initial: vm.Rates{Bit: 1e-5, Structural: 1e-5}}
+	genome, _ := e.vm.RandomProgram(10, e.rng).MarshalBinary()
+	ind := &Individual{Genome: genome}
+	changed := 0
+	for i := 0; i < 100; i++ {
+		before := ind.Rates
+		if op := e.mutate(ind); op != 0 {
+			continue
+		}
+		if ind.Rates == nil {
+			t.Fatal("Expected rates after mutation")
+		}
+		if before != nil && *before != *ind.Rates {
+			changed++
+		}
+	}
+	if changed < 50 {
+		t.Error("Expected the rates to drift without genome mutations, changed", changed, "times")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// The island model. Every island is an Engine with its own population, random source and
+// virtual machine, and islands evolve in parallel. At regular intervals, the best individuals
+// of every island are copied to other islands, where they replace the worst. Migration is
+// always done in island order, so a run with the same seed gives the same result.
+
+import (
+	"Aldcran/Fitness"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+)
+
+type Topology int
+
+const (
+	Ring           Topology = iota // Migrate to the next island
+	FullyConnected                 // Migrate to all other islands
+	RandomTopology                 // Migrate to one other island, chosen randomly every time
+)
+
+// An island model, created with NewIslands or ResumeIslands. The zero value is not usable.
+type Islands struct {
+	Engines         []*Engine
+	Topology        Topology
+	Interval        int    // Number of generations between migrations
+	Migrants        int    // Number of individuals sent from every island at every migration
+	Checkpoint      string // If set, all islands are saved to this file every CheckpointEvery generation
+	CheckpointEvery int
+	rng             *rand.Rand
+	source          *source
+}
+
+// Ids of individuals created on different islands never collide
+const islandIdShift = 40
+
+// Create n islands. Island i uses the seed c.Seed+i. The objective, selector and mutation
+// operator are shared by all islands, and have to be safe for concurrent use. The OnGeneration
+// callback of an Engine is called from the goroutine of the island. The checkpoint of c is
+// used for all islands together, see Islands.Save. Panics if n < 1.
+func NewIslands(n int, c Config, objective fitness.Objective) *Islands {
+	if n < 1 {
+		panic(fmt.Sprintf("evolve: invalid number of islands %d", n))
+	}
+	is := &Islands{Interval: 10, Migrants: 1, Checkpoint: c.Checkpoint, CheckpointEvery: c.CheckpointEvery}
+	is.setSource(newSource(c.Seed))
+	for i := 0; i < n; i++ {
+		ic := c
+		ic.Seed = c.Seed + int64(i)
+		ic.Checkpoint = "" // Islands are saved together, after migration
+		if c.Archive != "" {
+			ic.Archive = fmt.Sprintf("%s.%d", c.Archive, i)
+		}
+		e := New(ic, objective)
+		e.nextId = uint64(i) << islandIdShift
+		is.Engines = append(is.Engines, e)
+	}
+	return is
+}
+
+// Evolve all islands until the configured number of generations, and return the best individual
+func (is *Islands) Run() *Individual {
+	return is.RunContext(context.Background())
+}
+
+// Same as Run, but stops after the current migration if ctx is done, or if an archive
+// fails, see Err. The islands are then at the same generation, and can be saved.
+func (is *Islands) RunContext(ctx context.Context) *Individual {
+	is.parallel(func(e *Engine) {
+		if e.Population == nil {
+			e.Init()
+		}
+	})
+	for is.Generation() < is.Engines[0].Config.Generations && is.Err() == nil && ctx.Err() == nil {
+		before := is.Generation()
+		is.parallel(func(e *Engine) {
+			for i := 0; i < is.interval() && e.Generation < e.Config.Generations && e.err == nil; i++ {
+				e.Step()
+			}
+		})
+		is.Migrate()
+		if is.Checkpoint != "" && is.CheckpointEvery > 0 && is.Generation()/is.CheckpointEvery > before/is.CheckpointEvery {
+			if err := is.SaveFile(is.Checkpoint); err != nil {
+				log.Println("Failed to save checkpoint:", err)
+			}
+		}
+	}
+	for _, e := range is.Engines {
+		e.CloseArchive()
+	}
+	return is.Best()
+}
+
+func (is *Islands) setSource(src *source) {
+	is.source = src
+	is.rng = rand.New(src)
+}
+
+func (is *Islands) interval() int {
+	if is.Interval < 1 {
+		return 1
+	}
+	return is.Interval
+}
+
+// Run f on every island in its own goroutine, and wait for all to finish
+func (is *Islands) parallel(f func(e *Engine)) {
+	var wg sync.WaitGroup
+	for _, e := range is.Engines {
+		wg.Add(1)
+		go func(e *Engine) {
+			defer wg.Done()
+			f(e)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Copy the best individuals of every island to the destination islands
+func (is *Islands) Migrate() {
+	n := len(is.Engines)
+	if n < 2 || is.Migrants < 1 {
+		return
+	}
+	// Take all migrants before any island is changed
+	migrants := make([][]*Individual, n)
+	for i, e := range is.Engines {
+		for j := 0; j < is.Migrants && j < len(e.Population); j++ {
+			migrants[i] = append(migrants[i], e.Population[j].migrant())
+		}
+	}
+	incoming := make([][]*Individual, n)
+	for i := range is.Engines {
+		for _, dest := range is.destinations(i) {
+			for _, m := range migrants[i] {
+				incoming[dest] = append(incoming[dest], m.migrant())
+			}
+		}
+	}
+	for i, e := range is.Engines {
+		e.receive(incoming[i])
+	}
+}
+
+func (is *Islands) destinations(i int) []int {
+	n := len(is.Engines)
+	switch is.Topology {
+	case FullyConnected:
+		var ret []int
+		for j := 0; j < n; j++ {
+			if j != i {
+				ret = append(ret, j)
+			}
+		}
+		return ret
+	case RandomTopology:
+		j := is.rng.Intn(n - 1)
+		if j >= i {
+			j++
+		}
+		return []int{j}
+	}
+	return []int{(i + 1) % n}
+}
+
+// A copy that shares no memory with the original
+func (ind *Individual) migrant() *Individual {
+	m := *ind
+	m.Genome = append([]byte(nil), ind.Genome...)
+	m.Parents = append([]uint64(nil), ind.Parents...)
+	m.Behaviour = append([]float64(nil), ind.Behaviour...)
+	m.Result.Errors = append([]float64(nil), ind.Result.Errors...)
+	if ind.Rates != nil {
+		rates := *ind.Rates
+		m.Rates = &rates
+	}
+	return &m
+}
+
+// Replace the worst individuals with the migrants. A migrant gets a new id from the island,
+// with the original as its parent, so that an individual that returns to its original
+// island is not confused with itself. Migrants are not evaluated again, as all islands
+// share the objective. Until the next generation, they are ranked on the fitness adjusted
+// by novelty and parsimony in the source island.
+func (e *Engine) receive(migrants []*Individual) {
+	var received []*Individual
+	for i, m := range migrants {
+		pos := len(e.Population) - 1 - i
+		if pos < e.Config.Elitism || pos < 0 {
+			break
+		}
+		m.Parents = []uint64{m.Id}
+		m.Id = e.newId()
+		m.Operator = OpMigration | m.Operator&OpRejected // Still not evaluated
+		m.Delta = 0
+		e.Population[pos] = m
+		received = append(received, m)
+	}
+	e.record(received)
+	e.sort()
+}
+
+// The first archive error of any island, which stops Run
+func (is *Islands) Err() error {
+	for _, e := range is.Engines {
+		if err := e.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The generation of the island that is furthest behind
+func (is *Islands) Generation() int {
+	gen := is.Engines[0].Generation
+	for _, e := range is.Engines {
+		if e.Generation < gen {
+			gen = e.Generation
+		}
+	}
+	return gen
+}
+
+// The individual with the best task fitness on any island
+func (is *Islands) Best() (best *Individual) {
+	for _, e := range is.Engines {
+		if b := e.Best(); best == nil || b != nil && b.Result.Fitness < best.Result.Fitness {
+			best = b
+		}
+	}
+	return
+}
@@ -0,0 +1,186 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Fitness"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func islandConfig() Config {
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 12
+	return c
+}
+
+func TestIslands(t *testing.T) {
+	for _, topology := range []Topology{Ring, FullyConnected, RandomTopology} {
+		is := NewIslands(4, islandConfig(), store42)
+		is.Topology = topology
+		is.Interval = 3
+		is.Migrants = 2
+		best := is.Run()
+		if is.Generation() != 12 {
+			t.Error("Expected 12 generations, got", is.Generation())
+		}
+		// Every island shall have received individuals from other islands, with new ids
+		for i, e := range is.Engines {
+			foreign := 0
+			for _, ind := range e.Population {
+				if ind.Id>>islandIdShift != uint64(i) {
+					t.Error("Topology", topology, "island", i, "has the id", ind.Id, "of another island")
+				}
+				if ind.Operator == OpMigration && ind.Parents[0]>>islandIdShift != uint64(i) {
+					foreign++
+				}
+			}
+			if foreign == 0 && topology != RandomTopology {
+				t.Error("Topology", topology, "island", i, "has no migrants")
+			}
+		}
+		// Run again, and expect the same result
+		is2 := NewIslands(4, islandConfig(), store42)
+		is2.Topology = topology
+		is2.Interval = 3
+		is2.Migrants = 2
+		best2 := is2.Run()
+		if best.Id != best2.Id || string(best.Genome) != string(best2.Genome) {
+			t.Error("Topology", topology, "is not reproducible")
+		}
+	}
+}
+
+// A migrant that returns to its original island shall not have the id of the original
+func TestMigrantReturns(t *testing.T) {
+	is := NewIslands(2, islandConfig(), store42)
+	is.Migrants = 10
+	is.Engines[0].Config.Elitism, is.Engines[1].Config.Elitism = 0, 0
+	is.parallel(func(e *Engine) { e.Init() })
+	original := is.Engines[0].Population[0]
+	is.Migrate()
+	is.Migrate() // Island 0 gets copies of its own individuals back, and still has them
+	seen := make(map[uint64]bool)
+	for _, ind := range is.Engines[0].Population {
+		if seen[ind.Id] {
+			t.Error("Duplicate id", ind.Id)
+		}
+		seen[ind.Id] = true
+	}
+	var returned *Individual
+	for _, ind := range is.Engines[0].Population {
+		if string(ind.Genome) == string(original.Genome) && ind.Operator == OpMigration {
+			returned = ind
+		}
+	}
+	if returned == nil || returned.Id == original.Id || returned.Parents[0]>>islandIdShift != 1 {
+		t.Error("Expected a returned migrant with a new id and a parent on island 1, got", returned)
+	}
+}
+
+// A cancelled run stops after the migration, and can be continued
+func TestIslandsContext(t *testing.T) {
+	full := NewIslands(4, islandConfig(), store42)
+	full.Interval = 3
+	expected := full.Run()
+
+	is := NewIslands(4, islandConfig(), store42)
+	is.Interval = 3
+	ctx, cancel := context.WithCancel(context.Background())
+	is.Engines[0].OnGeneration = func(s Stats) {
+		if s.Generation == 4 {
+			cancel()
+		}
+	}
+	is.RunContext(ctx)
+	for i, e := range is.Engines {
+		if e.Generation != 6 {
+			t.Error("Expected island", i, "to stop after the migration in generation 6, got", e.Generation)
+		}
+	}
+	if best := is.Run(); best.Id != expected.Id || best.Result.Fitness != expected.Result.Fitness {
+		t.Error("Expected the same best individual as an uninterrupted run, got", best.Id, "and", expected.Id)
+	}
+}
+
+func TestMigrantCopy(t *testing.T) {
+	ind := &Individual{Id: 1, Genome: []byte{1, 2, 3}, Behaviour: []float64{1}, Result: fitness.Result{Errors: []float64{1}}}
+	m := ind.migrant()
+	m.Genome[0] = 9
+	m.Behaviour[0] = 9
+	m.Result.Errors[0] = 9
+	if ind.Genome[0] != 1 || ind.Behaviour[0] != 1 || ind.Result.Errors[0] != 1 {
+		t.Error("A migrant shall not share memory with the original")
+	}
+}
+
+func TestNoIslands(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected NewIslands to panic for", n, "islands")
+				}
+			}()
+			NewIslands(n, islandConfig(), store42)
+		}()
+	}
+}
+
+// All islands are saved together, and a resumed island model continues exactly the same way
+func TestResumeIslands(t *testing.T) {
+	islands := func(c Config) *Islands {
+		is := NewIslands(4, c, store42)
+		is.Topology = RandomTopology
+		is.Interval = 3
+		return is
+	}
+	full := islands(islandConfig())
+	full.Run()
+
+	c := islandConfig()
+	c.Generations = 6
+	c.Checkpoint = filepath.Join(t.TempDir(), "islands.ckpt")
+	c.CheckpointEvery = 3
+	islands(c).Run()
+	is, err := ResumeIslandsFile(c.Checkpoint, store42)
+	if err != nil {
+		t.Fatal("ResumeIslandsFile returned", err)
+	}
+	if len(is.Engines) != 4 || is.Generation() != 6 || is.Checkpoint != c.Checkpoint {
+		t.Fatal("Expected 4 islands from generation 6, got", len(is.Engines), is.Generation())
+	}
+	for _, e := range is.Engines {
+		e.Config.Generations = 12
+	}
+	is.Checkpoint = ""
+	is.Run()
+	for i := range full.Engines {
+		samePopulation(t, full.Engines[i].Population, is.Engines[i].Population)
+	}
+	if _, err := ResumeFile(c.Checkpoint, store42); err == nil {
+		t.Error("Expected an error when resuming an engine from an island checkpoint")
+	}
+	engine := filepath.Join(t.TempDir(), "engine.ckpt")
+	New(islandConfig(), store42).SaveFile(engine)
+	if _, err := ResumeIslandsFile(engine, store42); err == nil {
+		t.Error("Expected an error when resuming islands from an engine checkpoint")
+	}
+}
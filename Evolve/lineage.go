@@ -0,0 +1,163 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// Genealogy of the individuals. Every child remembers the operators that created it and
+// the change of fitness from the best parent. If Config.Archive is set, every new
+// individual is written to an archive file, which can be analysed afterwards.
+
+import (
+	"Aldcran/Archive"
+	"Aldcran/VirtualMachine"
+	"math"
+	"strings"
+)
+
+// A set of genetic operators
+type Operator uint8
+
+const (
+	OpMerge      Operator = 1 << iota
+	OpBit                 // Bit or field mutation
+	OpStructural          // Structural mutation
+	OpLibrary             // Inlined subroutine
+	OpMutation            // Any other mutation operator
+	OpMigration           // Copied from another island
+	OpRejected            // Killed by the Tarpeian method without being evaluated
+)
+
+var operatorNames = []string{"merge", "bit", "structural", "library", "mutation", "migration", "rejected"}
+
+// The names joined with "+", e.g. "merge+bit". Empty for no operator.
+func (o Operator) String() string {
+	var names []string
+	for i, name := range operatorNames {
+		if o&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+func operatorOf(m vm.Mutator) Operator {
+	switch m.(type) {
+	case vm.BitMutation, *vm.BitMutation, *vm.FieldMutation:
+		return OpBit
+	case *vm.StructuralMutation:
+		return OpStructural
+	case vm.LibraryInsert, *vm.LibraryInsert:
+		return OpLibrary
+	}
+	return OpMutation
+}
+
+// Compute the fitness change of new children. The parent fitness is not needed after
+// that, and is cleared so it need not be part of a checkpoint. Rejected children have
+// no fitness of their own, and no change.
+func setDelta(children []*Individual) {
+	for _, ind := range children {
+		if ind.Operator&OpRejected == 0 {
+			ind.Delta = ind.Result.Fitness - ind.parentFitness
+		}
+		ind.parentFitness = 0
+	}
+}
+
+// Write new individuals to the archive. The index is written when a checkpoint is saved,
+// and the archive stays open. A resumed run continues the archive in place from the size
+// it had at the checkpoint, without the entries that a crashed run added after it. An
+// error stops the run, see Err.
+func (e *Engine) record(list []*Individual) {
+	if e.Config.Archive == "" || e.err != nil {
+		return
+	}
+	if e.lineage == nil {
+		var err error
+		if e.Generation == 0 {
+			e.lineage, err = archive.Create(e.Config.Archive)
+		} else if e.archiveSize > 0 {
+			e.lineage, err = archive.AppendAt(e.Config.Archive, e.archiveSize)
+		} else {
+			last := e.Generation - 1 // The generation of the parents
+			e.lineage, err = archive.Append(e.Config.Archive, func(a archive.Entry) bool {
+				return a.Generation <= last
+			})
+		}
+		if err != nil {
+			e.err = err
+			return
+		}
+	}
+	for _, ind := range list {
+		entry := archive.Entry{
+			Id:         ind.Id,
+			Generation: e.Generation,
+			Fitness:    ind.Result.Fitness,
+			Penalties:  ind.Result.Penalties,
+			Parents:    ind.Parents,
+			Operator:   ind.Operator.String(),
+			Delta:      ind.Delta,
+			Rates:      ind.Rates,
+			Genome:     ind.Genome,
+		}
+		if ind.Operator&OpRejected != 0 {
+			// The result only ranks the individual last, it is not a fitness
+			entry.Fitness, entry.Penalties, entry.Delta = math.NaN(), 0, math.NaN()
+		}
+		err := e.lineage.Add(entry)
+		if err != nil {
+			e.err = err
+			return
+		}
+	}
+}
+
+// Write the index and close the archive, if any. It is done by Run, but has to be called
+// if the engine is used with Step.
+func (e *Engine) CloseArchive() error {
+	if e.lineage == nil {
+		return nil
+	}
+	err := e.lineage.Close()
+	if err == nil {
+		e.archiveSize = e.lineage.Size()
+	} else if e.err == nil {
+		e.err = err
+	}
+	e.lineage = nil
+	return err
+}
+
+// Write the index of the archive, if any, so that it is complete up to a checkpoint
+func (e *Engine) flushArchive() error {
+	if e.lineage == nil {
+		return nil
+	}
+	err := e.lineage.Flush()
+	if err == nil {
+		e.archiveSize = e.lineage.Size()
+	} else if e.err == nil {
+		e.err = err
+	}
+	return err
+}
+
+// The first error from the archive. Recording stops at an error, and so does Run.
+func (e *Engine) Err() error {
+	return e.err
+}
@@ -0,0 +1,239 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Archive"
+	"Aldcran/VirtualMachine"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOperatorString(t *testing.T) {
+	for _, test := range []struct {
+		op   Operator
+		name string
+	}{
+		{0, ""},
+		{OpMerge, "merge"},
+		{OpMerge | OpBit, "merge+bit"},
+		{OpStructural | OpLibrary | OpMutation, "structural+library+mutation"},
+	} {
+		if s := test.op.String(); s != test.name {
+			t.Error("Expected", test.name, "got", s)
+		}
+	}
+}
+
+func TestLineage(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 10
+	c.Archive = filepath.Join(t.TempDir(), "lineage.arc")
+	e := New(c, store42)
+	e.Mutation = vm.Pipeline{&vm.StructuralMutation{Insert: 0.1, Delete: 0.1}, vm.BitMutation{Prob: 0.01}}
+	e.Run()
+	r, err := archive.Open(c.Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	entries := r.Entries()
+	if expected := c.PopulationSize + c.Generations*(c.PopulationSize-c.Elitism); len(entries) != expected {
+		t.Fatal("Expected", expected, "entries, got", len(entries))
+	}
+	byId := make(map[uint64]archive.Entry)
+	operators := make(map[string]int)
+	for _, entry := range entries {
+		byId[entry.Id] = entry
+		operators[entry.Operator]++
+	}
+	for _, entry := range entries {
+		if entry.Generation == 0 {
+			if len(entry.Parents) != 0 || entry.Operator != "" || entry.Delta != 0 {
+				t.Error("Random individual with lineage", entry)
+			}
+			continue
+		}
+		best := math.Inf(1)
+		for _, id := range entry.Parents {
+			parent, ok := byId[id]
+			if !ok {
+				t.Fatal("Parent", id, "of", entry.Id, "is missing")
+			}
+			if parent.Generation >= entry.Generation {
+				t.Error("Parent", id, "is not older than", entry.Id)
+			}
+			best = math.Min(best, parent.Fitness)
+		}
+		if len(entry.Parents) == 0 || entry.Delta != entry.Fitness-best {
+			t.Error("Wrong delta", entry.Delta, "for", entry.Id, "with best parent", best)
+		}
+	}
+	for _, name := range []string{"merge", "bit", "structural"} {
+		found := false
+		for op := range operators {
+			for _, part := range strings.Split(op, "+") {
+				found = found || part == name
+			}
+		}
+		if !found {
+			t.Error("Operator", name, "never used", operators)
+		}
+	}
+	if e.lineage != nil {
+		t.Error("Archive was not closed")
+	}
+}
+
+func TestIslandLineage(t *testing.T) {
+	c := islandConfig()
+	c.Archive = filepath.Join(t.TempDir(), "islands.arc")
+	is := NewIslands(2, c, store42)
+	is.Run()
+	for i := 0; i < 2; i++ {
+		r, err := archive.Open(fmt.Sprintf("%s.%d", c.Archive, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range r.Entries() {
+			if entry.Id>>islandIdShift != uint64(i) {
+				t.Error("Island", i, "recorded individual", entry.Id)
+			}
+			if entry.Operator == "migration" && entry.Parents[0]>>islandIdShift == uint64(i) {
+				t.Error("Island", i, "recorded migrant", entry.Id, "from itself")
+			}
+		}
+		if len(r.Entries()) == 0 {
+			t.Error("Island", i, "has an empty archive")
+		}
+		r.Close()
+	}
+}
+
+// Ids and generations of an archive
+func archiveContents(t *testing.T, name string) map[uint64]int {
+	r, err := archive.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ret := make(map[uint64]int)
+	for _, entry := range r.Entries() {
+		ret[entry.Id] = entry.Generation
+	}
+	return ret
+}
+
+// A run that crashes after a checkpoint shall be resumed with the archive of the
+// checkpoint, and give the same archive as a run that did not crash
+func TestLineageResume(t *testing.T) {
+	dir := t.TempDir()
+	c := DefaultConfig()
+	c.PopulationSize = 10
+	c.Generations = 8
+	c.Archive = filepath.Join(dir, "full.arc")
+	New(c, store42).Run()
+	expected := archiveContents(t, c.Archive)
+
+	c.Archive = filepath.Join(dir, "crash.arc")
+	c.Checkpoint = filepath.Join(dir, "crash.ckpt")
+	c.CheckpointEvery = 4
+	crashed := New(c, store42)
+	crashed.Init()
+	for i := 0; i < 6; i++ {
+		crashed.Step() // Never closed, as if the run crashed in generation 6
+	}
+	checkpoint, err := os.ReadFile(c.Checkpoint) // From generation 4
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := ResumeFile(c.Checkpoint, store42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Run()
+	if e.Err() != nil {
+		t.Fatal("Resumed run failed:", e.Err())
+	}
+	if got := archiveContents(t, c.Archive); !reflect.DeepEqual(got, expected) {
+		t.Error("Expected", len(expected), "entries like the full run, got", len(got))
+	}
+
+	// Resume from the checkpoint again, when the archive is newer than it
+	e, _ = Resume(bytes.NewReader(checkpoint), store42)
+	if e.Generation != 4 {
+		t.Fatal("Expected a checkpoint from generation 4, got", e.Generation)
+	}
+	e.Run()
+	if got := archiveContents(t, c.Archive); e.Err() != nil || !reflect.DeepEqual(got, expected) {
+		t.Error("Expected the same archive after resuming an older checkpoint, got", len(got), e.Err())
+	}
+}
+
+// Rejected children are recorded without a fitness
+func TestRejectedLineage(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 5
+	c.Bloat.Tarpeian = 1
+	c.Archive = filepath.Join(t.TempDir(), "lineage.arc")
+	e := New(c, store42)
+	growing(e)
+	e.Run()
+	r, err := archive.Open(c.Archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	rejected := 0
+	for _, entry := range r.Entries() {
+		if strings.Contains(entry.Operator, "rejected") {
+			rejected++
+			if !math.IsNaN(entry.Fitness) || !math.IsNaN(entry.Delta) {
+				t.Error("Expected no fitness for a rejected child, got", entry.Fitness, entry.Delta)
+			}
+		} else if math.IsNaN(entry.Fitness) {
+			t.Error("Expected a fitness for", entry.Id)
+		}
+	}
+	if rejected == 0 {
+		t.Error("Expected rejected children")
+	}
+	if s := e.Stats(); math.IsNaN(s.Mean) || s.Best > s.Mean || s.Mean > s.Worst {
+		t.Error("Unexpected statistics", s)
+	}
+}
+
+// An archive that cannot be written stops the run
+func TestLineageError(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 10
+	c.Archive = filepath.Join(t.TempDir(), "missing", "lineage.arc")
+	e := New(c, store42)
+	e.Run()
+	if e.Err() == nil || e.Generation != 0 {
+		t.Error("Expected the run to stop at generation 0 with an error, got", e.Generation, e.Err())
+	}
+}
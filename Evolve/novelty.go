@@ -0,0 +1,162 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// Novelty search rewards programs that behave differently from the rest. The behaviour
+// of a program is the outputs and penalties from a fixed set of probe inputs. The novelty
+// is the mean distance to the K nearest neighbours, among the population and an archive
+// of earlier novel behaviours. Only new individuals can be archived, and a behaviour is
+// archived once. A full archive replaces a random old behaviour.
+
+import (
+	"Aldcran/VirtualMachine"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+type Novelty struct {
+	Layout    vm.Layout
+	Probes    [][]int // Inputs used for the fingerprint
+	K         int     // Number of nearest neighbours. Default is 15.
+	Weight    float64 // Fitness is (1-Weight)*task fitness - Weight*novelty, so 1 means novelty only
+	Threshold float64 // New individuals with higher novelty are added to the archive
+	MaxSize   int     // Maximum number of archived behaviours. Default is 1000.
+}
+
+// Run the program on all probes. The penalties are added last.
+func (n *Novelty) fingerprint(m *vm.VirtualMachine, genome []byte) (ret []float64) {
+	p := m.NewProgram()
+	p.UnmarshalBinary(genome)
+	var penalties int
+	for _, input := range n.Probes {
+		m.Reset()
+		output, pen, _ := p.Call(n.Layout, input)
+		for _, o := range output {
+			ret = append(ret, float64(o))
+		}
+		penalties += pen
+	}
+	return append(ret, float64(penalties))
+}
+
+func behaviourDistance(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		if i < len(b) {
+			sum += (a[i] - b[i]) * (a[i] - b[i])
+		}
+	}
+	return math.Sqrt(sum)
+}
+
+// The mean distance to the k nearest of others. The behaviour itself is not counted.
+func sparseness(b []float64, self int, others [][]float64, k int) float64 {
+	var dist []float64
+	for i, o := range others {
+		if i != self {
+			dist = append(dist, behaviourDistance(b, o))
+		}
+	}
+	if len(dist) == 0 {
+		return 0
+	}
+	sort.Float64s(dist)
+	if k > len(dist) {
+		k = len(dist)
+	}
+	var sum float64
+	for _, d := range dist[:k] {
+		sum += d
+	}
+	return sum / float64(k)
+}
+
+// Compute the novelty of the population, update the fitness and the novelty archive
+func (e *Engine) applyNovelty() {
+	n := e.Novelty
+	if n == nil {
+		return
+	}
+	fresh := make(map[*Individual]bool)
+	for _, ind := range e.Population {
+		if ind.Behaviour == nil {
+			ind.Behaviour = n.fingerprint(e.vm, ind.Genome)
+			fresh[ind] = true
+		}
+	}
+	k := n.K
+	if k == 0 {
+		k = 15
+	}
+	all := make([][]float64, 0, len(e.Population)+len(e.novelties))
+	for _, ind := range e.Population {
+		all = append(all, ind.Behaviour)
+	}
+	all = append(all, e.novelties...)
+	var novel [][]float64
+	for i, ind := range e.Population {
+		novelty := sparseness(ind.Behaviour, i, all, k)
+		ind.Fitness = (1-n.Weight)*ind.Result.Fitness - n.Weight*novelty
+		if fresh[ind] && novelty > n.Threshold {
+			novel = append(novel, ind.Behaviour)
+		}
+	}
+	for _, b := range novel {
+		e.addNovel(b)
+	}
+}
+
+// Add a behaviour to the novelty archive, unless it is already there
+func (e *Engine) addNovel(b []float64) {
+	if e.noveltyKeys == nil {
+		e.noveltyKeys = make(map[string]bool, len(e.novelties))
+		for _, a := range e.novelties {
+			e.noveltyKeys[behaviourKey(a)] = true
+		}
+	}
+	key := behaviourKey(b)
+	if e.noveltyKeys[key] {
+		return
+	}
+	e.noveltyKeys[key] = true
+	max := e.Novelty.MaxSize
+	if max == 0 {
+		max = 1000
+	}
+	if len(e.novelties) < max {
+		e.novelties = append(e.novelties, b)
+		return
+	}
+	i := e.rng.Intn(len(e.novelties))
+	delete(e.noveltyKeys, behaviourKey(e.novelties[i]))
+	e.novelties[i] = b
+}
+
+func behaviourKey(b []float64) string {
+	key := make([]byte, 0, 8*len(b))
+	for _, v := range b {
+		key = binary.LittleEndian.AppendUint64(key, math.Float64bits(v))
+	}
+	return string(key)
+}
+
+// Number of behaviours in the novelty archive
+func (e *Engine) NoveltyArchiveSize() int {
+	return len(e.novelties)
+}
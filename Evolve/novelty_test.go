@@ -0,0 +1,142 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/VirtualMachine"
+	"math"
+	"testing"
+)
+
+func TestSparseness(t *testing.T) {
+	behaviours := [][]float64{{0, 0}, {3, 4}, {6, 8}, {0, 1}}
+	if s := sparseness(behaviours[0], 0, behaviours, 1); s != 1 {
+		t.Error("Expected distance 1 to the nearest, got", s)
+	}
+	if s := sparseness(behaviours[0], 0, behaviours, 2); s != 3 {
+		t.Error("Expected mean distance 3 to the two nearest, got", s)
+	}
+	if s := sparseness(behaviours[2], 2, behaviours, 10); math.Abs(s-(5+10+math.Sqrt(36+49))/3) > 1e-9 {
+		t.Error("Unexpected mean distance to all", s)
+	}
+}
+
+func noveltyConfig() Config {
+	c := DefaultConfig()
+	c.PopulationSize = 20
+	c.Generations = 10
+	return c
+}
+
+func TestNovelty(t *testing.T) {
+	n := &Novelty{
+		Layout:    vm.Layout{Input: []int{1}, Output: []int{2, 3}},
+		Probes:    [][]int{{0}, {5}},
+		K:         3,
+		Weight:    1,
+		Threshold: 10,
+	}
+	e := New(noveltyConfig(), store42)
+	e.Novelty = n
+	e.Run()
+	if e.NoveltyArchiveSize() == 0 {
+		t.Error("Expected novel behaviours in the archive")
+	}
+	for _, ind := range e.Population {
+		if len(ind.Behaviour) != 5 {
+			t.Fatal("Expected a fingerprint of 2 probes with 2 outputs and the penalties, got", ind.Behaviour)
+		}
+		if ind.Fitness > 0 {
+			t.Error("With novelty only, fitness shall be minus the novelty, got", ind.Fitness)
+		}
+	}
+
+	// Blended with task fitness
+	n.Weight = 0.5
+	e = New(noveltyConfig(), store42)
+	e.Novelty = n
+	e.Init()
+	for _, ind := range e.Population {
+		if ind.Fitness > 0.5*ind.Result.Fitness {
+			t.Error("Expected fitness at most half of the task fitness, got", ind.Fitness, ind.Result.Fitness)
+		}
+	}
+}
+
+// Without weight, novelty does not change the fitness
+func TestNoveltyWeightZero(t *testing.T) {
+	e := New(noveltyConfig(), store42)
+	e.Novelty = &Novelty{Layout: vm.Layout{Output: []int{1}}, Probes: [][]int{nil}}
+	e.Init()
+	for _, ind := range e.Population {
+		if ind.Fitness != ind.Result.Fitness {
+			t.Error("Expected task fitness", ind.Result.Fitness, "got", ind.Fitness)
+		}
+	}
+}
+
+// With the default threshold, the archive shall still only get distinct behaviours of
+// new individuals, and not grow beyond the limit
+func TestNoveltyArchiveLimit(t *testing.T) {
+	e := New(noveltyConfig(), store42)
+	e.Novelty = &Novelty{Layout: vm.Layout{Input: []int{1}, Output: []int{2}}, Probes: [][]int{{0}, {7}}, MaxSize: 30}
+	var sizes []int
+	e.OnGeneration = func(s Stats) {
+		sizes = append(sizes, e.NoveltyArchiveSize())
+	}
+	e.Run()
+	for i := 1; i < len(sizes); i++ {
+		if sizes[i]-sizes[i-1] > e.Config.PopulationSize-e.Config.Elitism {
+			t.Error("Archive grew more than the number of children:", sizes)
+		}
+	}
+	if e.NoveltyArchiveSize() > 30 {
+		t.Error("Expected at most 30 archived behaviours, got", e.NoveltyArchiveSize())
+	}
+	seen := make(map[string]bool)
+	for _, b := range e.novelties {
+		if seen[behaviourKey(b)] {
+			t.Error("Duplicate behaviour in the archive", b)
+		}
+		seen[behaviourKey(b)] = true
+	}
+}
+
+// The hall of fame shall be ranked on the task fitness, not on novelty from the
+// generation an individual was in
+func TestNoveltyHallOfFame(t *testing.T) {
+	c := noveltyConfig()
+	c.HallOfFame = 5
+	e := New(c, store42)
+	e.Novelty = &Novelty{Layout: vm.Layout{Output: []int{1}}, Probes: [][]int{nil}, Weight: 1}
+	best := math.Inf(1)
+	e.OnGeneration = func(s Stats) {
+		for _, ind := range e.Population {
+			best = math.Min(best, ind.Result.Fitness)
+		}
+	}
+	e.Run()
+	if e.HallOfFame[0].Result.Fitness != best {
+		t.Error("Expected the best task fitness", best, "first in the hall of fame, got", e.HallOfFame[0].Result.Fitness)
+	}
+	for i := 1; i < len(e.HallOfFame); i++ {
+		if e.HallOfFame[i].Result.Fitness < e.HallOfFame[i-1].Result.Fitness {
+			t.Error("Hall of fame not sorted on task fitness")
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// Multi-objective optimisation with NSGA-II. The objectives are the task error,
+// the penalties, the execution cost and the program length, all minimised.
+
+import (
+	"Aldcran/VirtualMachine"
+	"encoding/csv"
+	"encoding/hex"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+)
+
+const numObjectives = 4
+
+// NSGA-II selection. Parents are chosen by a binary tournament on rank and crowding
+// distance, and the next generation is chosen from both parents and children.
+type Pareto struct{}
+
+// Selectors that also choose who survives to the next generation
+type survivor interface {
+	// Choose n individuals
+	Survive(pop []*Individual, n int) []*Individual
+}
+
+func (ind *Individual) objectives() [numObjectives]float64 {
+	return [numObjectives]float64{
+		ind.Result.Error,
+		float64(ind.Result.Penalties),
+		float64(ind.Result.Cost),
+		float64(len(ind.Genome) / vm.InstructionSize),
+	}
+}
+
+// True if a is at least as good as b in all objectives, and better in at least one
+func dominates(a, b *Individual) bool {
+	oa, ob := a.objectives(), b.objectives()
+	better := false
+	for i := range oa {
+		if oa[i] > ob[i] {
+			return false
+		}
+		if oa[i] < ob[i] {
+			better = true
+		}
+	}
+	return better
+}
+
+// Sort into fronts, where the first front is not dominated by anyone. The rank
+// of an individual is the index of its front.
+func nondominatedSort(pop []*Individual) (fronts [][]*Individual) {
+	dominatedBy := make([]int, len(pop)) // Number of individuals dominating i
+	dominating := make([][]int, len(pop))
+	var front []int
+	for i := range pop {
+		for j := range pop {
+			if dominates(pop[i], pop[j]) {
+				dominating[i] = append(dominating[i], j)
+			} else if dominates(pop[j], pop[i]) {
+				dominatedBy[i]++
+			}
+		}
+		if dominatedBy[i] == 0 {
+			front = append(front, i)
+		}
+	}
+	for rank := 0; len(front) > 0; rank++ {
+		var next []int
+		var list []*Individual
+		for _, i := range front {
+			pop[i].rank = rank
+			list = append(list, pop[i])
+			for _, j := range dominating[i] {
+				dominatedBy[j]--
+				if dominatedBy[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		fronts = append(fronts, list)
+		front = next
+	}
+	return
+}
+
+// Compute the crowding distance of every individual in a front. Boundary individuals get infinite distance.
+func crowdingDistance(front []*Individual) {
+	for _, ind := range front {
+		ind.crowding = 0
+	}
+	for o := 0; o < numObjectives; o++ {
+		sort.SliceStable(front, func(i, j int) bool {
+			return front[i].objectives()[o] < front[j].objectives()[o]
+		})
+		min, max := front[0].objectives()[o], front[len(front)-1].objectives()[o]
+		front[0].crowding = math.Inf(1)
+		front[len(front)-1].crowding = math.Inf(1)
+		if max == min {
+			continue
+		}
+		for i := 1; i < len(front)-1; i++ {
+			front[i].crowding += (front[i+1].objectives()[o] - front[i-1].objectives()[o]) / (max - min)
+		}
+	}
+}
+
+// Lower rank is better, and for equal rank higher crowding distance is better
+func crowdedLess(a, b *Individual) bool {
+	if a.rank != b.rank {
+		return a.rank < b.rank
+	}
+	return a.crowding > b.crowding
+}
+
+func (s Pareto) Select(pop []*Individual, r *rand.Rand) *Individual {
+	a, b := pop[r.Intn(len(pop))], pop[r.Intn(len(pop))]
+	if crowdedLess(b, a) {
+		return b
+	}
+	return a
+}
+
+func (s Pareto) Survive(pop []*Individual, n int) []*Individual {
+	var next []*Individual
+	for _, front := range nondominatedSort(pop) {
+		crowdingDistance(front)
+		if len(next)+len(front) <= n {
+			next = append(next, front...)
+			continue
+		}
+		sort.SliceStable(front, func(i, j int) bool {
+			return crowdedLess(front[i], front[j])
+		})
+		next = append(next, front[:n-len(next)]...)
+		break
+	}
+	return next
+}
+
+// The individuals that are not dominated by anyone else
+func Front(pop []*Individual) []*Individual {
+	if len(pop) == 0 {
+		return nil
+	}
+	list := append([]*Individual(nil), pop...)
+	return nondominatedSort(list)[0]
+}
+
+// Write the Pareto front of the population as CSV, sorted on error. The genome is hex encoded.
+func (e *Engine) WriteFront(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = WriteFront(f, Front(e.Population))
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func WriteFront(w io.Writer, front []*Individual) error {
+	front = append([]*Individual(nil), front...)
+	sort.SliceStable(front, func(i, j int) bool {
+		return front[i].Result.Error < front[j].Result.Error
+	})
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "fitness", "error", "penalties", "cost", "length", "genome"})
+	for _, ind := range front {
+		cw.Write([]string{
+			strconv.FormatUint(ind.Id, 10),
+			strconv.FormatFloat(ind.Fitness, 'g', -1, 64),
+			strconv.FormatFloat(ind.Result.Error, 'g', -1, 64),
+			strconv.Itoa(ind.Result.Penalties),
+			strconv.Itoa(ind.Result.Cost),
+			strconv.Itoa(len(ind.Genome) / vm.InstructionSize),
+			hex.EncodeToString(ind.Genome),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,95 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// An individual with the given error and length, and no penalties or cost
+func point(id uint64, err float64, length int) *Individual {
+	return &Individual{Id: id, Result: fitness.Result{Error: err}, Genome: make([]byte, length*vm.InstructionSize)}
+}
+
+func TestNondominatedSort(t *testing.T) {
+	pop := []*Individual{
+		point(0, 1, 5),
+		point(1, 5, 1),
+		point(2, 3, 3),
+		point(3, 4, 4), // Dominated by 2
+		point(4, 5, 5), // Dominated by everyone
+	}
+	fronts := nondominatedSort(pop)
+	if len(fronts) != 3 || len(fronts[0]) != 3 || len(fronts[1]) != 1 || len(fronts[2]) != 1 {
+		t.Fatal("Unexpected fronts", fronts)
+	}
+	if pop[3].rank != 1 || pop[4].rank != 2 {
+		t.Error("Unexpected ranks", pop[3].rank, pop[4].rank)
+	}
+	crowdingDistance(fronts[0])
+	if !math.IsInf(pop[0].crowding, 1) || !math.IsInf(pop[1].crowding, 1) || math.IsInf(pop[2].crowding, 1) {
+		t.Error("Expected infinite distance only for the boundaries, got", pop[0].crowding, pop[1].crowding, pop[2].crowding)
+	}
+	if front := Front(pop); len(front) != 3 {
+		t.Error("Expected a front of 3, got", front)
+	}
+
+	// Keep the whole first front, and the best of the rest
+	next := Pareto{}.Survive(pop, 4)
+	if len(next) != 4 || next[3].Id != 3 {
+		t.Error("Unexpected survivors", next)
+	}
+}
+
+func TestParetoEngine(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 30
+	c.Generations = 10
+	c.FrontFile = filepath.Join(t.TempDir(), "front.csv")
+	e := New(c, store42)
+	e.Selector = Pareto{}
+	e.Mutation = vm.Pipeline{&vm.StructuralMutation{Insert: 0.2, Delete: 0.2}, vm.BitMutation{Prob: 0.01}}
+	e.Run()
+	if _, err := os.Stat(c.FrontFile); err != nil {
+		t.Error("Expected the front to be written:", err)
+	}
+	if len(e.Population) != c.PopulationSize {
+		t.Error("Expected population size", c.PopulationSize, "got", len(e.Population))
+	}
+	front := Front(e.Population)
+	for _, a := range front {
+		for _, b := range front {
+			if dominates(a, b) {
+				t.Error(a.Id, "dominates", b.Id, "in the front")
+			}
+		}
+	}
+	var buf bytes.Buffer
+	WriteFront(&buf, front)
+	if lines := strings.Count(buf.String(), "\n"); lines != len(front)+1 {
+		t.Error("Expected", len(front)+1, "lines, got", lines)
+	}
+	t.Log("\n", buf.String())
+}
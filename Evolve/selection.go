@@ -0,0 +1,159 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Chooses a parent. The population is sorted on fitness, best first.
+type Selector interface {
+	Select(pop []*Individual, r *rand.Rand) *Individual
+}
+
+// The best of Size randomly chosen individuals. As the population is sorted, the one
+// with the lowest index is the best, which also takes tie-breaking into account.
+type Tournament struct {
+	Size int
+}
+
+// Linear ranking. Pressure is the expected number of selections of the best individual
+// per generation, between 1 (no pressure) and 2. The default is 1.5, and other values
+// are limited to the range.
+type Rank struct {
+	Pressure float64
+}
+
+// Fitness proportional selection. As lower fitness is better, the weight of an
+// individual is 1/(1+f-best), where best is the lowest fitness in the population.
+type Roulette struct{}
+
+// Uniform selection among the best Fraction of the population
+type Truncation struct {
+	Fraction float64
+}
+
+// Lexicase selection, using the errors of every test case in the fitness Result. Test
+// cases are considered in random order, and only the individuals with the lowest error
+// on a case are kept. Individuals without test case errors are compared on fitness.
+type Lexicase struct{}
+
+func (s Tournament) Select(pop []*Individual, r *rand.Rand) *Individual {
+	best := r.Intn(len(pop))
+	for i := 1; i < s.Size; i++ {
+		if j := r.Intn(len(pop)); j < best {
+			best = j
+		}
+	}
+	return pop[best]
+}
+
+func (s Rank) Select(pop []*Individual, r *rand.Rand) *Individual {
+	n := float64(len(pop))
+	if len(pop) == 1 {
+		return pop[0]
+	}
+	pressure := s.Pressure
+	if pressure == 0 {
+		pressure = 1.5
+	}
+	pressure = math.Max(1, math.Min(2, pressure))
+	// The weight of rank i (0 is best) is (2-s)/n + 2(s-1)(n-1-i)/(n(n-1)), which sums to 1
+	choice := r.Float64()
+	for i := range pop {
+		choice -= (2-pressure)/n + 2*(pressure-1)*(n-1-float64(i))/(n*(n-1))
+		if choice < 0 {
+			return pop[i]
+		}
+	}
+	return pop[len(pop)-1]
+}
+
+func (s Roulette) Select(pop []*Individual, r *rand.Rand) *Individual {
+	best := pop[0].Fitness
+	for _, ind := range pop {
+		if ind.Fitness < best {
+			best = ind.Fitness
+		}
+	}
+	var sum float64
+	for _, ind := range pop {
+		sum += 1 / (1 + ind.Fitness - best)
+	}
+	choice := r.Float64() * sum
+	for _, ind := range pop {
+		choice -= 1 / (1 + ind.Fitness - best)
+		if choice < 0 {
+			return ind
+		}
+	}
+	return pop[len(pop)-1]
+}
+
+func (s Truncation) Select(pop []*Individual, r *rand.Rand) *Individual {
+	n := int(s.Fraction * float64(len(pop)))
+	if n < 1 {
+		n = 1
+	}
+	if n > len(pop) {
+		n = len(pop)
+	}
+	return pop[r.Intn(n)]
+}
+
+func (s Lexicase) Select(pop []*Individual, r *rand.Rand) *Individual {
+	candidates := append([]*Individual(nil), pop...)
+	cases := len(pop[0].Result.Errors)
+	for _, c := range r.Perm(cases) {
+		if len(candidates) == 1 {
+			break
+		}
+		best := candidates[0].caseError(c)
+		for _, ind := range candidates[1:] {
+			if e := ind.caseError(c); e < best {
+				best = e
+			}
+		}
+		keep := candidates[:0]
+		for _, ind := range candidates {
+			if ind.caseError(c) == best {
+				keep = append(keep, ind)
+			}
+		}
+		candidates = keep
+	}
+	if cases == 0 {
+		best := pop[0]
+		for _, ind := range pop {
+			if ind.Fitness < best.Fitness {
+				best = ind
+			}
+		}
+		return best
+	}
+	return candidates[r.Intn(len(candidates))]
+}
+
+// The error of test case c. Missing errors are treated as the fitness.
+func (ind *Individual) caseError(c int) float64 {
+	if c < len(ind.Result.Errors) {
+		return ind.Result.Errors[c]
+	}
+	return ind.Fitness
+}
@@ -0,0 +1,168 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/Fitness"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const (
+	popSize    = 20
+	selections = 100000
+)
+
+// Individual i has fitness i
+func rankedPopulation() (pop []*Individual) {
+	for i := 0; i < popSize; i++ {
+		pop = append(pop, &Individual{Id: uint64(i), Fitness: float64(i)})
+	}
+	return
+}
+
+// The relative frequency of every individual being selected
+func frequencies(s Selector, pop []*Individual) []float64 {
+	r := rand.New(rand.NewSource(1))
+	freq := make([]float64, len(pop))
+	for i := 0; i < selections; i++ {
+		freq[s.Select(pop, r).Id]++
+	}
+	for i := range freq {
+		freq[i] /= selections
+	}
+	return freq
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestTournament(t *testing.T) {
+	pop := rankedPopulation()
+	for _, size := range []int{1, 2, 7} {
+		freq := frequencies(Tournament{Size: size}, pop)
+		// The best is selected if it is part of the tournament
+		exp := 1 - math.Pow(1-1.0/popSize, float64(size))
+		if !near(freq[0], exp) {
+			t.Error("Tournament size", size, "expected probability", exp, "for the best, got", freq[0])
+		}
+		// The worst can only win against itself
+		exp = math.Pow(1.0/popSize, float64(size))
+		if !near(freq[popSize-1], exp) {
+			t.Error("Tournament size", size, "expected probability", exp, "for the worst, got", freq[popSize-1])
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	pop := rankedPopulation()
+	for _, pressure := range []float64{1, 1.5, 2} {
+		freq := frequencies(Rank{Pressure: pressure}, pop)
+		if math.Abs(freq[0]*popSize-pressure) > 0.1 {
+			t.Error("Pressure", pressure, "expected", pressure, "selections of the best per generation, got", freq[0]*popSize)
+		}
+		if exp := (2 - pressure) / popSize; !near(freq[popSize-1], exp) {
+			t.Error("Pressure", pressure, "expected probability", exp, "for the worst, got", freq[popSize-1])
+		}
+	}
+	// The zero value shall not favour the worst, and values outside the range are limited
+	for _, test := range []struct{ pressure, expected float64 }{{0, 1.5}, {-1, 1}, {5, 2}} {
+		freq := frequencies(Rank{Pressure: test.pressure}, pop)
+		if math.Abs(freq[0]*popSize-test.expected) > 0.1 {
+			t.Error("Pressure", test.pressure, "expected", test.expected, "selections of the best per generation, got", freq[0]*popSize)
+		}
+	}
+}
+
+func TestRoulette(t *testing.T) {
+	pop := rankedPopulation()
+	freq := frequencies(Roulette{}, pop)
+	var sum float64
+	for i := range pop {
+		sum += 1 / (1 + float64(i))
+	}
+	for _, i := range []int{0, 1, popSize - 1} {
+		if exp := 1 / (1 + float64(i)) / sum; !near(freq[i], exp) {
+			t.Error("Expected probability", exp, "for individual", i, "got", freq[i])
+		}
+	}
+}
+
+func TestTruncation(t *testing.T) {
+	pop := rankedPopulation()
+	freq := frequencies(Truncation{Fraction: 0.25}, pop)
+	for i := range freq {
+		if i < popSize/4 && !near(freq[i], 4.0/popSize) {
+			t.Error("Expected uniform selection of the best quarter, got", freq[i], "for", i)
+		}
+		if i >= popSize/4 && freq[i] != 0 {
+			t.Error("Individual", i, "is outside of the best quarter")
+		}
+	}
+}
+
+// Every individual is a specialist on one test case, except the last one which is
+// mediocre on everything but has the best total error.
+func TestLexicase(t *testing.T) {
+	var pop []*Individual
+	const cases = 4
+	for i := 0; i < cases; i++ {
+		errors := []float64{10, 10, 10, 10}
+		errors[i] = 0
+		pop = append(pop, &Individual{Id: uint64(i), Fitness: 30, Result: fitness.Result{Errors: errors}})
+	}
+	pop = append([]*Individual{{Id: cases, Fitness: 20, Result: fitness.Result{Errors: []float64{5, 5, 5, 5}}}}, pop...)
+	freq := frequencies(Lexicase{}, pop)
+	for i := 0; i < cases; i++ {
+		if !near(freq[i], 1.0/cases) {
+			t.Error("Expected the specialists to be selected uniformly, got", freq[i], "for", i)
+		}
+	}
+	if freq[cases] != 0 {
+		t.Error("The generalist should never be selected")
+	}
+
+	// Without errors, the best fitness is chosen
+	pop = rankedPopulation()
+	if freq := frequencies(Lexicase{}, pop); freq[0] != 1 {
+		t.Error("Expected the best to be chosen, got", freq[0])
+	}
+}
+
+// Higher tournament size gives higher selection pressure
+func TestSelectionPressure(t *testing.T) {
+	pop := rankedPopulation()
+	mean := func(s Selector) (m float64) {
+		for i, f := range frequencies(s, pop) {
+			m += float64(i) * f
+		}
+		return
+	}
+	uniform := mean(Tournament{Size: 1})
+	if math.Abs(uniform-float64(popSize-1)/2) > 0.1 {
+		t.Error("Expected mean rank", float64(popSize-1)/2, "for uniform selection, got", uniform)
+	}
+	if mean(Tournament{Size: 2}) >= uniform || mean(Tournament{Size: 7}) >= mean(Tournament{Size: 2}) {
+		t.Error("Expected higher pressure from larger tournaments")
+	}
+	if mean(Rank{Pressure: 2}) >= mean(Rank{Pressure: 1.2}) {
+		t.Error("Expected higher pressure from higher rank pressure")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+// Speciation clusters the population on edit distance, to protect new lineages from
+// being taken over by the currently best one. Every individual is assigned to the first
+// species whose representative is within the threshold, or else starts a new species.
+// As the population is sorted, the representative is the best individual of the species.
+// With explicit fitness sharing, the score of every member is divided by the size of the
+// species, and the species get children in proportion to the sum of the shared scores.
+// Species with the same fitness get the same number of children, whatever their sizes.
+// Sharing only decides the offspring quotas. Individual.Fitness is not changed, so
+// selection within a species and elitism use the unshared fitness.
+
+import (
+	"Aldcran/MergePrograms"
+	"Aldcran/VirtualMachine"
+	"math"
+)
+
+type Species struct {
+	Members   []*Individual // Sorted on fitness, best first. The first is the representative.
+	Offspring int           // Number of children in the next generation
+	share     float64       // Proportion of children
+}
+
+// Number of diversity samples per individual
+const diversitySamples = 10
+
+func distance(a, b *Individual) int {
+	return merge.Distance(a.Genome, b.Genome, vm.InstructionSize)
+}
+
+// Divide the population into species, and compute the proportion of children for each
+func (e *Engine) speciate() {
+	e.Species = nil
+	if e.Config.SpeciesThreshold == 0 {
+		return
+	}
+	for _, ind := range e.Population {
+		var species *Species
+		for _, s := range e.Species {
+			if distance(s.Members[0], ind) <= e.Config.SpeciesThreshold {
+				species = s
+				break
+			}
+		}
+		if species == nil {
+			species = &Species{}
+			e.Species = append(e.Species, species)
+		}
+		species.Members = append(species.Members, ind)
+	}
+	// Fitness sharing. Lower fitness is better, so the score of an individual is 1/(1+f),
+	// where f is the fitness relative to the best. Fitness can be negative with novelty.
+	best := math.Inf(1)
+	for _, ind := range e.Population {
+		best = math.Min(best, ind.Fitness)
+	}
+	var sum float64
+	for _, s := range e.Species {
+		for _, ind := range s.Members {
+			s.share += 1 / (1 + ind.Fitness - best) / float64(len(s.Members))
+		}
+		sum += s.share
+	}
+	for _, s := range e.Species {
+		s.share /= sum
+	}
+	e.assignQuotas(e.Config.PopulationSize - e.Config.Elitism)
+}
+
+// Distribute n children using the largest remainder method, so that the sum is exactly n
+func (e *Engine) assignQuotas(n int) {
+	given := 0
+	for _, s := range e.Species {
+		s.Offspring = int(s.share * float64(n))
+		given += s.Offspring
+	}
+	for given < n {
+		best := e.Species[0]
+		for _, s := range e.Species {
+			if s.share*float64(n)-float64(s.Offspring) > best.share*float64(n)-float64(best.Offspring) {
+				best = s
+			}
+		}
+		best.Offspring++
+		given++
+	}
+}
+
+// The mean edit distance, in instructions, from every individual to a sample of others
+func Diversity(pop []*Individual) float64 {
+	n := len(pop)
+	if n < 2 {
+		return 0
+	}
+	samples := diversitySamples
+	if samples > n-1 {
+		samples = n - 1
+	}
+	var sum float64
+	for i := range pop {
+		for k := 0; k < samples; k++ {
+			j := (i + 1 + k*(n-1)/samples) % n
+			sum += float64(distance(pop[i], pop[j]))
+		}
+	}
+	return sum / float64(n*samples)
+}
@@ -0,0 +1,120 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package evolve
+
+import (
+	"Aldcran/VirtualMachine"
+	"testing"
+)
+
+// A genome of n instructions, where every instruction is the value v
+func uniform(id uint64, v byte, n int, f float64) *Individual {
+	genome := make([]byte, n*vm.InstructionSize)
+	for i := range genome {
+		genome[i] = v
+	}
+	return &Individual{Id: id, Genome: genome, Fitness: f}
+}
+
+func TestSpeciate(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 6
+	c.Elitism = 0
+	c.SpeciesThreshold = 2
+	e := New(c, store42)
+	// Two clusters that are far apart. The large cluster is better, but has more members to share with.
+	e.Population = []*Individual{
+		uniform(1, 1, 5, 1),
+		uniform(2, 1, 6, 1),
+		uniform(3, 1, 4, 1),
+		uniform(4, 1, 5, 1),
+		uniform(5, 2, 5, 2),
+		uniform(6, 2, 6, 2),
+	}
+	e.speciate()
+	if len(e.Species) != 2 {
+		t.Fatal("Expected 2 species, got", len(e.Species))
+	}
+	if len(e.Species[0].Members) != 4 || len(e.Species[1].Members) != 2 {
+		t.Error("Unexpected species sizes", len(e.Species[0].Members), len(e.Species[1].Members))
+	}
+	// The shared scores are 1 for the first species and 1/2 for the second
+	if e.Species[0].Offspring != 4 || e.Species[1].Offspring != 2 {
+		t.Error("Unexpected quotas", e.Species[0].Offspring, e.Species[1].Offspring)
+	}
+	children := e.breedChildren(6)
+	if len(children) != 6 {
+		t.Error("Expected 6 children, got", len(children))
+	}
+	e.assignQuotas(7)
+	if e.Species[0].Offspring+e.Species[1].Offspring != 7 {
+		t.Error("Quotas shall sum to the number of children")
+	}
+}
+
+// A species of many clones shall not get more children than a single individual with the same fitness
+func TestFitnessSharing(t *testing.T) {
+	for _, f := range []float64{0, 1, -3} {
+		c := DefaultConfig()
+		c.PopulationSize = 11
+		c.Elitism = 1
+		c.SpeciesThreshold = 2
+		e := New(c, store42)
+		e.Population = []*Individual{uniform(11, 2, 5, f)}
+		for id := uint64(1); id <= 10; id++ {
+			e.Population = append(e.Population, uniform(id, 1, 5, f))
+		}
+		e.speciate()
+		if len(e.Species) != 2 || e.Species[0].Offspring != 5 || e.Species[1].Offspring != 5 {
+			t.Error("Fitness", f, "expected 5 children for each species, got", e.Species[0].Offspring, e.Species[1].Offspring)
+		}
+	}
+}
+
+func TestDiversity(t *testing.T) {
+	same := []*Individual{uniform(1, 1, 5, 0), uniform(2, 1, 5, 0), uniform(3, 1, 5, 0)}
+	if d := Diversity(same); d != 0 {
+		t.Error("Expected no diversity, got", d)
+	}
+	different := []*Individual{uniform(1, 1, 5, 0), uniform(2, 2, 5, 0)}
+	if d := Diversity(different); d != 10 {
+		t.Error("Expected diversity 10, got", d)
+	}
+}
+
+func TestSpeciationEngine(t *testing.T) {
+	c := DefaultConfig()
+	c.PopulationSize = 30
+	c.Generations = 10
+	c.SpeciesThreshold = 3
+	var stats []Stats
+	e := New(c, store42)
+	e.OnGeneration = func(s Stats) {
+		stats = append(stats, s)
+	}
+	e.Run()
+	if len(e.Population) != c.PopulationSize {
+		t.Error("Expected population size", c.PopulationSize, "got", len(e.Population))
+	}
+	for _, s := range stats {
+		if s.Species == 0 || s.Diversity == 0 {
+			t.Error("Expected species and diversity in generation", s.Generation, s)
+		}
+	}
+	t.Log("Last generation:", stats[len(stats)-1])
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Definition of problems, and evaluation of programs on them. A fitness is always
+// a value where lower is better, and 0 is a perfect solution.
+package fitness
+
+import (
+	"Aldcran/VirtualMachine"
+	"math"
+)
+
+// A test case. If Score is nil, the error is the sum of absolute differences to Expected.
+type Case struct {
+	Input    []int
+	Expected []int
+	Score    func(output []int) float64 // The error of an output
+}
+
+// A problem defined by test cases
+type Problem interface {
+	Layout() vm.Layout // Where to put inputs and find outputs
+	Cases() []Case
+}
+
+type Result struct {
+	Fitness   float64   // Combined value, lower is better
+	Error     float64   // Sum of Errors
+	Errors    []float64 // The error for every test case
+	Penalties int
+	Cost      int // Number of executed instructions
+}
+
+// Anything that can evaluate a program, e.g. a Harness or a simulation
+type Objective interface {
+	Evaluate(m *vm.VirtualMachine, genome []byte) Result
+}
+
+// A custom objective
+type Func func(m *vm.VirtualMachine, genome []byte) Result
+
+// How the parts of a Result are combined into a fitness
+type Weights struct {
+	Error   float64
+	Penalty float64
+	Cost    float64
+}
+
+// Evaluates programs on all test cases of a problem
+type Harness struct {
+	Problem Problem
+	Weights Weights
+}
+
+// A problem given as a list of test cases
+type Table struct {
+	IO   vm.Layout
+	List []Case
+}
+
+var DefaultWeights = Weights{Error: 1, Penalty: 0.01, Cost: 0}
+
+func (f Func) Evaluate(m *vm.VirtualMachine, genome []byte) Result {
+	return f(m, genome)
+}
+
+func (t *Table) Layout() vm.Layout {
+	return t.IO
+}
+
+func (t *Table) Cases() []Case {
+	return t.List
+}
+
+func NewHarness(p Problem) *Harness {
+	return &Harness{Problem: p, Weights: DefaultWeights}
+}
+
+// Run the program on every test case, starting from cleared memory
+func (h *Harness) Evaluate(m *vm.VirtualMachine, genome []byte) (r Result) {
+	p := m.NewProgram()
+	p.UnmarshalBinary(genome)
+	layout := h.Problem.Layout()
+	for _, c := range h.Problem.Cases() {
+		m.Reset()
+		output, penalties, cost := p.Call(layout, c.Input)
+		e := c.Error(output)
+		r.Errors = append(r.Errors, e)
+		r.Error += e
+		r.Penalties += penalties
+		r.Cost += cost
+	}
+	r.Fitness = h.Weights.Combine(r)
+	return
+}
+
+func (c *Case) Error(output []int) float64 {
+	if c.Score != nil {
+		return c.Score(output)
+	}
+	var sum float64
+	for i, exp := range c.Expected {
+		if i < len(output) {
+			sum += math.Abs(float64(output[i] - exp))
+		} else {
+			sum += math.Abs(float64(exp))
+		}
+	}
+	return sum
+}
+
+func (w Weights) Combine(r Result) float64 {
+	return w.Error*r.Error + w.Penalty*float64(r.Penalties) + w.Cost*float64(r.Cost)
+}
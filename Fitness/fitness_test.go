@@ -0,0 +1,77 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package fitness
+
+import (
+	"Aldcran/VirtualMachine"
+	"testing"
+)
+
+// Output the input plus one
+var increment = &Table{
+	IO: vm.Layout{Input: []int{1}, Output: []int{2}},
+	List: []Case{
+		{Input: []int{0}, Expected: []int{1}},
+		{Input: []int{5}, Expected: []int{6}},
+		{Input: []int{-3}, Score: func(output []int) float64 {
+			if output[0] == -2 {
+				return 0
+			}
+			return 10
+		}},
+	},
+}
+
+func TestHarness(t *testing.T) {
+	m := vm.New(16, 10)
+	h := NewHarness(increment)
+	p := m.NewProgram()
+	p.UnmarshalText([]byte("addImmediate=1 addIndirect=1 storeAddress=2"))
+	genome, _ := p.MarshalBinary()
+	r := h.Evaluate(m, genome)
+	if r.Fitness != 0 || r.Error != 0 || r.Penalties != 0 || len(r.Errors) != 3 {
+		t.Error("Expected a perfect solution, got", r)
+	}
+	if r.Cost != 3 {
+		t.Error("Expected cost 3, got", r.Cost)
+	}
+
+	// Store the constant 1, and also store outside of memory
+	p = m.NewProgram()
+	p.UnmarshalText([]byte("addImmediate=1 storeAddress=2\naddImmediate=1 storeAddress=100"))
+	genome, _ = p.MarshalBinary()
+	r = h.Evaluate(m, genome)
+	if r.Errors[0] != 0 || r.Errors[1] != 5 || r.Errors[2] != 10 {
+		t.Error("Unexpected errors", r.Errors)
+	}
+	if r.Penalties == 0 {
+		t.Error("Expected penalties")
+	}
+	if exp := r.Error + DefaultWeights.Penalty*float64(r.Penalties); r.Fitness != exp {
+		t.Error("Expected fitness", exp, "got", r.Fitness)
+	}
+}
+
+func TestFunc(t *testing.T) {
+	var o Objective = Func(func(m *vm.VirtualMachine, genome []byte) Result {
+		return Result{Fitness: float64(len(genome))}
+	})
+	if r := o.Evaluate(nil, make([]byte, 3)); r.Fitness != 3 {
+		t.Error("Expected fitness 3, got", r.Fitness)
+	}
+}
@@ -20,7 +20,8 @@ package merge
 
 import "math/rand"
 
-type program []byte
+// A program is a list of symbols. A symbol can be a byte, or a complete instruction.
+type program []uint32
 
 type step int
 
@@ -66,22 +67,28 @@ func findShortestPath2(a, b program) (int, []node) {
 	}
 	start := 0
 	end := 1
-	// TODO: Don't add nodes with x or y less than -1
 	for iter := 1; ; iter++ {
+		// Only the node that has come furthest on every diagonal is kept, as it
+		// dominates the others. Without this, the buffer grows exponentially.
+		furthest := make(map[int]int) // Diagonal (x-y) to index in buffer
 		for i := start; i < end; i++ {
 			n := buffer[i]
-			x, y = followDiag(n.x-1, n.y, a, b)
-			// log.Println("Iter", iter, "adding", x, ",", y)
-			buffer = append(buffer, node{x: x, y: y, next: i})
-			if x == -1 && y == -1 {
-				return iter, buffer
-			}
-
-			x, y = followDiag(n.x, n.y-1, a, b)
-			// log.Println("Iter", iter, "adding", x, ",", y)
-			buffer = append(buffer, node{x: x, y: y, next: i})
-			if x == -1 && y == -1 {
-				return iter, buffer
+			for _, move := range [2][2]int{{n.x - 1, n.y}, {n.x, n.y - 1}} {
+				if move[0] < -1 || move[1] < -1 {
+					continue // Outside of the string
+				}
+				x, y = followDiag(move[0], move[1], a, b)
+				if x == -1 && y == -1 {
+					return iter, append(buffer, node{x: x, y: y, next: i})
+				}
+				if j, ok := furthest[x-y]; ok {
+					if x < buffer[j].x {
+						buffer[j] = node{x: x, y: y, next: i}
+					}
+					continue
+				}
+				furthest[x-y] = len(buffer)
+				buffer = append(buffer, node{x: x, y: y, next: i})
 			}
 		}
 		start = end
@@ -125,6 +132,11 @@ func interpretPath(a, b program, list []node) path {
 
 // Take a path, do a random merge transform on two programs, and return the new program
 func (p path) randomMerge(p1, p2 program) (newProg program) {
+	return p.randomMergeWith(p1, p2, rand.Float32)
+}
+
+// The path has to be created from p1 to p2. The random function decides what parent to use for every deviation.
+func (p path) randomMergeWith(p1, p2 program, random func() float32) (newProg program) {
 	commonPath := true
 	newProg = program{}
 	var chooseX bool
@@ -140,7 +152,7 @@ func (p path) randomMerge(p1, p2 program) (newProg program) {
 		if commonPath {
 			// Detected a deviation that starts here
 			commonPath = false
-			if rand.Float32() > 0.5 {
+			if random() > 0.5 {
 				chooseX = true
 			} else {
 				chooseX = false
@@ -148,12 +160,12 @@ func (p path) randomMerge(p1, p2 program) (newProg program) {
 		}
 		if p[i] == right {
 			if chooseX {
-				newProg = append(newProg, p2[x])
+				newProg = append(newProg, p1[x])
 			}
 			x++
 		} else if p[i] == down {
 			if !chooseX {
-				newProg = append(newProg, p1[y])
+				newProg = append(newProg, p2[y])
 			}
 			y++
 		}
@@ -18,9 +18,107 @@
 // Based on http://www.xmailserver.org/diff2.pdf
 package merge
 
+import (
+	"math/rand"
+)
+
 // Do a random merge transform on two programs, and return the new program
 func RandomMerge(p1, p2 []byte) []byte {
-	_, p := findShortestPath(p1, p2)
-	newProg := p.randomMerge(p1, p2)
-	return newProg
+	return RandomMergeUnits(p1, p2, 1, nil)
+}
+
+// Do a random merge transform on two serialized programs, where every unit of size bytes is
+// treated as a whole. That way, instructions are never broken up. If r is nil, the default
+// random source is used.
+func RandomMergeUnits(p1, p2 []byte, size int, r *rand.Rand) []byte {
+	var s symbols
+	a, b := s.split(p1, size), s.split(p2, size)
+	_, p := findShortestPath(a, b)
+	random := rand.Float32
+	if r != nil {
+		random = r.Float32
+	}
+	return s.join(p.randomMergeWith(a, b, random))
+}
+
+// The edit distance between two serialized programs, counted in units of size bytes
+func Distance(p1, p2 []byte, size int) int {
+	var s symbols
+	cost, _ := findShortestPath2(s.split(p1, size), s.split(p2, size))
+	return cost
+}
+
+type Op int
+
+const (
+	Equal  Op = iota // The unit is in both programs
+	Delete           // The unit is only in the first program
+	Insert           // The unit is only in the second program
+)
+
+// One step in the transformation from the first program to the second. A and B are
+// unit indices in the first and second program, or -1 if not used by the Op.
+type Change struct {
+	Op   Op
+	A, B int
+}
+
+// The shortest list of changes that transforms p1 into p2, counted in units of size bytes
+func Diff(p1, p2 []byte, size int) []Change {
+	var s symbols
+	_, p := findShortestPath(s.split(p1, size), s.split(p2, size))
+	var ret []Change
+	var x, y int
+	for _, st := range p {
+		switch st {
+		case diag:
+			ret = append(ret, Change{Op: Equal, A: x, B: y})
+			x++
+			y++
+		case right:
+			ret = append(ret, Change{Op: Delete, A: x, B: -1})
+			x++
+		case down:
+			ret = append(ret, Change{Op: Insert, A: -1, B: y})
+			y++
+		}
+	}
+	return ret
+}
+
+// Conversion between units of bytes and symbols. Equal units get the same symbol.
+type symbols struct {
+	ids   map[string]uint32
+	units [][]byte
+}
+
+// A trailing partial unit is kept as a unit of its own
+func (s *symbols) split(data []byte, size int) program {
+	if s.ids == nil {
+		s.ids = make(map[string]uint32)
+	}
+	var ret program
+	for start := 0; start < len(data); start += size {
+		end := start + size
+		if end > len(data) {
+			end = len(data)
+		}
+		unit := data[start:end]
+		id, ok := s.ids[string(unit)]
+		if !ok {
+			id = uint32(len(s.units))
+			s.ids[string(unit)] = id
+			s.units = append(s.units, unit)
+		}
+		ret = append(ret, id)
+	}
+	return ret
+}
+
+func (s *symbols) join(p program) []byte {
+	var ret []byte
+	for _, id := range p {
+		ret = append(ret, s.units[id]...)
+	}
+	return ret
 }
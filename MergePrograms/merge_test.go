@@ -18,6 +18,7 @@
 package merge
 
 import (
+	"bytes"
 	"math/rand"
 	"testing"
 )
@@ -188,3 +189,96 @@ func TestMergeLong(t *testing.T) {
 	t.Log(y)
 	t.Log(newProg)
 }
+
+// Merging of instructions shall never break up an instruction
+func TestMergeUnits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	a := []byte{1, 1, 2, 2, 3, 3, 4, 4}
+	b := []byte{1, 1, 9, 9, 3, 3, 4, 4, 5, 5}
+	if d := Distance(a, b, 2); d != 3 {
+		t.Error("Expected distance 3, got", d)
+	}
+	if d := Distance(a, a, 2); d != 0 {
+		t.Error("Expected distance 0, got", d)
+	}
+	for i := 0; i < 20; i++ {
+		child := RandomMergeUnits(a, b, 2, r)
+		if len(child)%2 != 0 {
+			t.Fatal("Child", child, "has a broken unit")
+		}
+		for j := 0; j < len(child); j += 2 {
+			if child[j] != child[j+1] {
+				t.Fatal("Child", child, "has a broken unit")
+			}
+		}
+		if Distance(a, child, 2)+Distance(child, b, 2) != Distance(a, b, 2) {
+			t.Error("Child", child, "is not on a path between the parents")
+		}
+	}
+}
+
+// Compare with the cost computed from the longest common subsequence
+func TestFindPathRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 20; n++ {
+		x := make(program, r.Intn(200))
+		y := make(program, r.Intn(200))
+		for i := range x {
+			x[i] = uint32(r.Intn(4))
+		}
+		for i := range y {
+			y[i] = uint32(r.Intn(4))
+		}
+		lcs := make([][]int, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(y)+1)
+		}
+		for i := 1; i <= len(x); i++ {
+			for j := 1; j <= len(y); j++ {
+				if x[i-1] == y[j-1] {
+					lcs[i][j] = lcs[i-1][j-1] + 1
+				} else if lcs[i-1][j] > lcs[i][j-1] {
+					lcs[i][j] = lcs[i-1][j]
+				} else {
+					lcs[i][j] = lcs[i][j-1]
+				}
+			}
+		}
+		expCost := len(x) + len(y) - 2*lcs[len(x)][len(y)]
+		cost, p := findShortestPath(x, y)
+		if cost != expCost {
+			t.Error("Expected cost", expCost, "got", cost)
+		}
+		if len(p) != len(x)+len(y)-lcs[len(x)][len(y)] {
+			t.Error("Unexpected path length", len(p))
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	p1 := []byte{1, 1, 2, 2, 3, 3, 4, 4}
+	p2 := []byte{1, 1, 5, 5, 3, 3, 4, 4, 6, 6}
+	changes := Diff(p1, p2, 2)
+	var a, b []byte
+	var edits int
+	for _, c := range changes {
+		if c.Op != Insert {
+			a = append(a, p1[2*c.A:2*c.A+2]...)
+		}
+		if c.Op != Delete {
+			b = append(b, p2[2*c.B:2*c.B+2]...)
+		}
+		if c.Op == Equal && !bytes.Equal(p1[2*c.A:2*c.A+2], p2[2*c.B:2*c.B+2]) {
+			t.Error("Expected equal units at", c)
+		}
+		if c.Op != Equal {
+			edits++
+		}
+	}
+	if !bytes.Equal(a, p1) || !bytes.Equal(b, p2) {
+		t.Error("Expected the changes to cover both programs, got", changes)
+	}
+	if d := Distance(p1, p2, 2); edits != d || d != 3 {
+		t.Error("Expected 3 edits, got", edits, "and distance", d)
+	}
+}
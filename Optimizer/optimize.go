@@ -0,0 +1,134 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Use Aldcran as a control program, to optimize on parameters. An evolved program
+// writes the parameters into output memory cells, and the objective is minimized.
+package optimize
+
+import (
+	"Aldcran/Evolve"
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"math"
+)
+
+type Scale int
+
+const (
+	Linear Scale = iota
+	Log          // Min and Max must be positive
+)
+
+// A parameter, with bounds
+type Param struct {
+	Name     string
+	Min, Max float64
+	Scale    Scale
+}
+
+type Optimizer struct {
+	Params    []Param
+	Objective func(params []float64) float64 // Lower is better
+	Output    []int                          // Memory cells of the parameters. Default is 1, 2, ...
+	Steps     int                            // Memory values from -Steps to Steps cover the range of a parameter. Default is 1000.
+	Penalty   float64                        // Weight of VM penalties added to the objective. Usually 0, as only the parameters matter.
+}
+
+// The best parameters found
+type Solution struct {
+	Params []float64
+	Value  float64 // The objective of Params
+	Genome []byte  // The program that produced the parameters
+}
+
+func New(objective func(params []float64) float64, params ...Param) *Optimizer {
+	return &Optimizer{Params: params, Objective: objective}
+}
+
+func (o *Optimizer) layout() vm.Layout {
+	if o.Output != nil {
+		return vm.Layout{Output: o.Output}
+	}
+	var l vm.Layout
+	for i := range o.Params {
+		l.Output = append(l.Output, i+1) // Address 0 can't be stored to
+	}
+	return l
+}
+
+// Map memory values to parameters. Values outside of the range are clamped.
+func (o *Optimizer) Decode(output []int) []float64 {
+	steps := o.Steps
+	if steps == 0 {
+		steps = 1000
+	}
+	params := make([]float64, len(o.Params))
+	for i, p := range o.Params {
+		var v int
+		if i < len(output) {
+			v = output[i]
+		}
+		t := (float64(v) + float64(steps)) / float64(2*steps)
+		t = math.Max(0, math.Min(1, t))
+		switch p.Scale {
+		case Log:
+			params[i] = p.Min * math.Pow(p.Max/p.Min, t)
+		default:
+			params[i] = p.Min + t*(p.Max-p.Min)
+		}
+	}
+	return params
+}
+
+// Run the program and return the parameters it produced
+func (o *Optimizer) Parameters(m *vm.VirtualMachine, genome []byte) ([]float64, int) {
+	p := m.NewProgram()
+	p.UnmarshalBinary(genome)
+	output, penalties, _ := p.Call(o.layout(), nil)
+	return o.Decode(output), penalties
+}
+
+// The objective of the parameters produced by a program, which makes an Optimizer
+// usable as a fitness.Objective
+func (o *Optimizer) Evaluate(m *vm.VirtualMachine, genome []byte) (r fitness.Result) {
+	m.Reset()
+	params, penalties := o.Parameters(m, genome)
+	r.Error = o.Objective(params)
+	r.Errors = []float64{r.Error}
+	r.Penalties = penalties
+	r.Cost = len(genome) / vm.InstructionSize
+	r.Fitness = r.Error + o.Penalty*float64(penalties)
+	return
+}
+
+// Evolve programs with the configuration c, and return the best parameters. The memory
+// is made large enough for the output cells.
+func (o *Optimizer) Run(c evolve.Config) Solution {
+	for _, addr := range o.layout().Output {
+		if n := uint32(addr + 1); addr >= 0 && c.VM.MemorySize < n {
+			c.VM.MemorySize = n
+		}
+	}
+	e := evolve.New(c, o)
+	return o.solution(e.VM(), e.Run().Genome)
+}
+
+func (o *Optimizer) solution(m *vm.VirtualMachine, genome []byte) Solution {
+	m.Reset()
+	params, _ := o.Parameters(m, genome)
+	return Solution{Params: params, Value: o.Objective(params), Genome: genome}
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package optimize
+
+import (
+	"Aldcran/Evolve"
+	"math"
+	"testing"
+)
+
+func rosenbrock(x []float64) float64 {
+	var sum float64
+	for i := 0; i+1 < len(x); i++ {
+		sum += 100*(x[i+1]-x[i]*x[i])*(x[i+1]-x[i]*x[i]) + (1-x[i])*(1-x[i])
+	}
+	return sum
+}
+
+func rastrigin(x []float64) float64 {
+	sum := 10 * float64(len(x))
+	for _, v := range x {
+		sum += v*v - 10*math.Cos(2*math.Pi*v)
+	}
+	return sum
+}
+
+func TestDecode(t *testing.T) {
+	o := New(nil, Param{Min: -1, Max: 1}, Param{Min: 1, Max: 100, Scale: Log})
+	o.Steps = 10
+	p := o.Decode([]int{5, 0})
+	if p[0] != 0.5 || math.Abs(p[1]-10) > 1e-9 {
+		t.Error("Expected [0.5 10], got", p)
+	}
+	p = o.Decode([]int{-20, 20})
+	if p[0] != -1 || p[1] != 100 {
+		t.Error("Expected clamped values [-1 100], got", p)
+	}
+}
+
+func optimizeConfig() evolve.Config {
+	c := evolve.DefaultConfig()
+	c.PopulationSize = 200
+	c.Generations = 300
+	return c
+}
+
+func TestRosenbrock(t *testing.T) {
+	o := New(rosenbrock, Param{Name: "x", Min: -2, Max: 2}, Param{Name: "y", Min: -2, Max: 2})
+	s := o.Run(optimizeConfig())
+	t.Log("Rosenbrock", s.Params, s.Value)
+	if s.Value > 0.1 {
+		t.Error("Expected a value near 0, got", s.Value, "at", s.Params)
+	}
+}
+
+func TestRastrigin(t *testing.T) {
+	// The optimum is not in the middle of the range, where an empty program would find it
+	o := New(rastrigin, Param{Min: -3, Max: 5.12}, Param{Min: -5.12, Max: 2})
+	s := o.Run(optimizeConfig())
+	t.Log("Rastrigin", s.Params, s.Value)
+	// Rastrigin has many local optima, with a value of about 1 next to the global one
+	if s.Value > 2 {
+		t.Error("Expected a value near a local optimum close to 0, got", s.Value, "at", s.Params)
+	}
+}
+
+// The memory shall grow to fit an output cell beyond the configured size
+func TestOutputBeyondMemory(t *testing.T) {
+	o := New(func(x []float64) float64 { return math.Abs(x[0] - 1) }, Param{Min: -2, Max: 2})
+	o.Output = []int{40}
+	c := optimizeConfig()
+	c.Generations = 30
+	if s := o.Run(c); s.Value > 0.1 {
+		t.Error("Expected a value near 0, got", s.Value, "at", s.Params)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package problems
+
+// Construction of the reference solutions. The only computation an instruction can do
+// is a constant plus the value of one memory cell, so functions of the inputs are
+// computed with lookup tables, using indirect stores as conditions.
+//
+// A conditional store is an indirect store through a pointer cell that holds either the
+// real destination or 0. Cell 0 is never used for anything else.
+
+import (
+	"fmt"
+	"strings"
+)
+
+type assembler struct {
+	lines []string
+	next  int // The next free memory cell
+}
+
+func newAssembler(firstFree int) *assembler {
+	return &assembler{next: firstFree}
+}
+
+func (a *assembler) alloc(n int) int {
+	addr := a.next
+	a.next += n
+	return addr
+}
+
+// mem[dst] = imm + mem[src]. A src of 0 means only the constant.
+func (a *assembler) store(dst, imm, src int) {
+	a.lines = append(a.lines, fmt.Sprintf("addImmediate=%d addIndirect=%d storeAddress=%d", imm, src, dst))
+}
+
+// mem[mem[ptr]] = imm + mem[src]
+func (a *assembler) storeIndirect(ptr, imm, src int) {
+	a.lines = append(a.lines, fmt.Sprintf("addImmediate=%d addIndirect=%d storeIndirect=%d", imm, src, ptr))
+}
+
+// Allocate n pointer cells, where the one for value v of mem[in] gets the address
+// target, and the others get 0. The values of mem[in] are lo to lo+n-1.
+func (a *assembler) selector(in, lo, n, target int) int {
+	pointers := a.alloc(n)
+	for v := 0; v < n; v++ {
+		a.store(pointers+v, 0, 0)
+	}
+	p := a.alloc(1)
+	a.store(p, pointers-lo, in)
+	a.storeIndirect(p, target, 0)
+	return pointers
+}
+
+// mem[out] = f(mem[in]), for mem[in] from lo to lo+n-1
+func (a *assembler) lookup(in, lo, n, out int, f func(v int) int) {
+	pointers := a.selector(in, lo, n, out)
+	for v := 0; v < n; v++ {
+		a.storeIndirect(pointers+v, f(lo+v), 0)
+	}
+}
+
+// mem[out] = f(mem[x], mem[y]), for mem[x] from 0 to nx-1 and mem[y] from 0 to ny-1.
+// The output can be one of the inputs.
+func (a *assembler) lookup2(x, nx, y, ny, out int, f func(x, y int) int) {
+	g := a.alloc(1) // Gets the address out if the value of x is the current one
+	xs := a.selector(x, 0, nx, g)
+	ys := a.alloc(ny)
+	e := a.alloc(1) // Points to the cell in ys for the value of y
+	a.store(e, ys, y)
+	for vx := 0; vx < nx; vx++ {
+		a.store(g, 0, 0)
+		a.storeIndirect(xs+vx, out, 0)
+		for vy := 0; vy < ny; vy++ {
+			a.store(ys+vy, 0, 0)
+		}
+		a.storeIndirect(e, 0, g)
+		for vy := 0; vy < ny; vy++ {
+			a.storeIndirect(ys+vy, f(vx, vy), 0)
+		}
+	}
+}
+
+func (a *assembler) String() string {
+	return strings.Join(a.lines, "\n") + "\n"
+}
@@ -0,0 +1,217 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package problems
+
+import (
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"fmt"
+)
+
+// A problem where the cases are all combinations of input values from lo to lo+n-1
+func exhaustive(l vm.Layout, lo, n int, f func(input []int) int) *fitness.Table {
+	t := &fitness.Table{IO: l}
+	count := 1
+	for range l.Input {
+		count *= n
+	}
+	for c := 0; c < count; c++ {
+		input := make([]int, len(l.Input))
+		for i, v := 0, c; i < len(input); i, v = i+1, v/n {
+			input[i] = lo + v%n
+		}
+		t.List = append(t.List, fitness.Case{Input: input, Expected: []int{f(input)}})
+	}
+	return t
+}
+
+// Cells from first to first+n-1
+func cells(first, n int) []int {
+	ret := make([]int, n)
+	for i := range ret {
+		ret[i] = first + i
+	}
+	return ret
+}
+
+// Store 42 in cell 1
+func Store42() *Benchmark {
+	t := &fitness.Table{
+		IO:   vm.Layout{Output: []int{1}},
+		List: []fitness.Case{{Expected: []int{42}}},
+	}
+	return &Benchmark{Name: "store42", Objective: fitness.NewHarness(t), Solution: "addImmediate=42 storeAddress=1\n",
+		Config: config("store42", 16, 100)}
+}
+
+// Add 1 to the value in cell 1, and store it in cell 2
+func Increment() *Benchmark {
+	t := &fitness.Table{
+		IO: vm.Layout{Input: []int{1}, Output: []int{2}},
+		List: []fitness.Case{
+			{Input: []int{0}, Expected: []int{1}},
+			{Input: []int{3}, Expected: []int{4}},
+			{Input: []int{10}, Expected: []int{11}},
+		},
+	}
+	return &Benchmark{Name: "increment", Objective: fitness.NewHarness(t), Solution: "addImmediate=1 addIndirect=1 storeAddress=2\n",
+		Config: config("increment", 16, 100)}
+}
+
+// Symbolic regression of x^4, for x from 0 to 2
+func Quartic() *Benchmark {
+	f := func(x int) int { return x * x * x * x }
+	t := &fitness.Table{IO: vm.Layout{Input: []int{1}, Output: []int{2}}}
+	for x := 0; x <= 2; x++ {
+		t.List = append(t.List, fitness.Case{Input: []int{x}, Expected: []int{f(x)}})
+	}
+	a := newAssembler(3)
+	a.lookup(1, 0, 3, 2, f)
+	return &Benchmark{Name: "quartic", Objective: fitness.NewHarness(t), Solution: a.String(),
+		Config: hard("quartic", a.next), Islands: 4}
+}
+
+// Symbolic regression of x^4 + x^3 + x^2 + x, for x from 0 to 2
+func Koza1() *Benchmark {
+	f := func(x int) int { return x*x*x*x + x*x*x + x*x + x }
+	t := &fitness.Table{IO: vm.Layout{Input: []int{1}, Output: []int{2}}}
+	for x := 0; x <= 2; x++ {
+		t.List = append(t.List, fitness.Case{Input: []int{x}, Expected: []int{f(x)}})
+	}
+	a := newAssembler(3)
+	a.lookup(1, 0, 3, 2, f)
+	return &Benchmark{Name: "koza1", Objective: fitness.NewHarness(t), Solution: a.String(),
+		Config: hard("koza1", a.next), Islands: 4}
+}
+
+// The output in cell 1 is 1 if an even number of the n input bits are 1. The inputs
+// follow the output, so that an input bit can be used as a pointer to it.
+func EvenParity(n int) *Benchmark {
+	name := fmt.Sprintf("parity%d", n)
+	t := exhaustive(vm.Layout{Input: cells(2, n), Output: []int{1}}, 0, 2, func(input []int) int {
+		parity := 1
+		for _, b := range input {
+			parity ^= b
+		}
+		return parity
+	})
+	// Cell 1 has the parity so far and inv the inverse, which are swapped for every 1 bit
+	a := newAssembler(n + 2)
+	unused := a.alloc(1)
+	inv := a.alloc(1) // Has to follow unused
+	tmp, p := a.alloc(1), a.alloc(1)
+	a.store(1, 1, 0)
+	a.store(inv, 0, 0)
+	for i := 2; i <= n+1; i++ {
+		a.store(tmp, 0, 1)
+		a.storeIndirect(i, 0, inv)
+		a.store(p, unused, i)
+		a.storeIndirect(p, 0, tmp)
+	}
+	return &Benchmark{Name: name, Objective: fitness.NewHarness(t), Solution: a.String(),
+		Config: hard(name, a.next), Islands: 4}
+}
+
+// The output is the data bit selected by k address bits. The address bits come first,
+// with the most significant first, followed by the 2^k data bits.
+func Multiplexer(k int) *Benchmark {
+	data := 1 << uint(k)
+	name := fmt.Sprintf("multiplexer%d", k+data)
+	out := k + data + 1
+	t := exhaustive(vm.Layout{Input: cells(1, k+data), Output: []int{out}}, 0, 2, func(input []int) int {
+		var addr int
+		for _, b := range input[:k] {
+			addr = 2*addr + b
+		}
+		return input[k+addr]
+	})
+	a := newAssembler(out + 1)
+	addr := a.alloc(1)
+	a.store(addr, 0, 1)
+	for i := 2; i <= k; i++ {
+		a.lookup2(addr, 1<<uint(i-1), i, 2, addr, func(x, y int) int { return 2*x + y })
+	}
+	pointers := a.selector(addr, 0, data, out)
+	for v := 0; v < data; v++ {
+		a.storeIndirect(pointers+v, 0, k+1+v)
+	}
+	return &Benchmark{Name: name, Objective: fitness.NewHarness(t), Solution: a.String(),
+		Config: hard(name, a.next), Islands: 4}
+}
+
+// The sum of an array of n bits. There is no indirect read, but a bit can be used as
+// a pointer to cell 0 or 1, so cell 1 can count the 1 bits.
+func SumOfArray(n int) *Benchmark {
+	name := fmt.Sprintf("sum%d", n)
+	out := n + 1
+	t := exhaustive(vm.Layout{Input: cells(1, n), Output: []int{out}}, 0, 2, func(input []int) (sum int) {
+		for _, v := range input {
+			sum += v
+		}
+		return
+	})
+	a := newAssembler(out + 1)
+	for i := 2; i <= n; i++ {
+		a.storeIndirect(i, 1, 1)
+	}
+	a.store(out, 0, 1)
+	return &Benchmark{Name: name, Objective: fitness.NewHarness(t), Solution: a.String(),
+		Config: hard(name, a.next), Islands: 4}
+}
+
+// The maximum of two values from 1 to 3. The values can be used as pointers to the inputs
+// and the output.
+func MaxOfTwo() *Benchmark {
+	t := exhaustive(vm.Layout{Input: []int{1, 2}, Output: []int{3}}, 1, 3, func(input []int) int {
+		if input[0] > input[1] {
+			return input[0]
+		}
+		return input[1]
+	})
+	solution := "addIndirect=2 storeIndirect=1\naddIndirect=1 storeAddress=3\naddIndirect=2 storeIndirect=2\n"
+	c := hard("max", 4)
+	c.Generations = 1000
+	return &Benchmark{Name: "max", Objective: fitness.NewHarness(t), Solution: solution,
+		Config: c, Islands: 4}
+}
+
+// The program is called n times without clearing the memory, and shall output 1, 2, ..., n
+// in cell 1.
+func Counting(n int) *Benchmark {
+	name := fmt.Sprintf("count%d", n)
+	l := vm.Layout{Output: []int{1}}
+	objective := fitness.Func(func(m *vm.VirtualMachine, genome []byte) (r fitness.Result) {
+		p := m.NewProgram()
+		p.UnmarshalBinary(genome)
+		m.Reset()
+		for i := 1; i <= n; i++ {
+			output, penalties, cost := p.Call(l, nil)
+			e := fitness.Case{Expected: []int{i}}
+			r.Errors = append(r.Errors, e.Error(output))
+			r.Error += r.Errors[i-1]
+			r.Penalties += penalties
+			r.Cost += cost
+		}
+		r.Fitness = fitness.DefaultWeights.Combine(r)
+		return
+	})
+	c := config(name, 4, 300)
+	c.InitialLength = 1
+	return &Benchmark{Name: name, Objective: objective, Solution: "addImmediate=1 addIndirect=1 storeAddress=1\n",
+		Config: c, Islands: 4}
+}
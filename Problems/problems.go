@@ -0,0 +1,117 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+// Standard genetic programming benchmarks, adapted to the integer memory model of the
+// virtual machine. Every problem has a hand written solution, which tests the execution.
+// Every benchmark also has a reference configuration that is known to solve it, which
+// tests the genetic operators. An instruction can only add a constant to one memory cell,
+// so most functions of the inputs need lookup tables of indirect stores. The problems are
+// therefore kept small enough for evolution to find these tables.
+package problems
+
+import (
+	"Aldcran/Evolve"
+	"Aldcran/Fitness"
+	"Aldcran/VirtualMachine"
+	"fmt"
+)
+
+type Benchmark struct {
+	Name      string
+	Objective fitness.Objective
+	Config    evolve.Config // The reference configuration, with room for the solution in memory
+	Islands   int           // Number of islands in the reference configuration, 0 for one engine
+	Solution  string        // A perfect program, in the text format
+}
+
+// The mutation used with the reference configurations. The clear and multiplication
+// fields are not mutated, as they have no effect when every instruction starts from 0.
+// Small changes of constants and addresses are more likely than large. The sign bit is
+// also mutated, which changes n to -1-n.
+func Mutation() vm.Mutator {
+	return vm.Pipeline{
+		&vm.StructuralMutation{Insert: 0.1, InsertNoop: 0.05, Delete: 0.1, Duplicate: 0.05, Swap: 0.05, Move: 0.05, MaxLength: 30},
+		&vm.FieldMutation{
+			Rates:      [vm.NumFields]float32{vm.FieldAddImmediate: 0.1, vm.FieldAddIndirect: 0.1, vm.FieldStoreAddress: 0.1, vm.FieldStoreIndirect: 0.1},
+			BitWeights: []float32{8, 4, 2, 1, 0.5, 0.25, 15: 1},
+		},
+	}
+}
+
+// Evolve with the reference configuration, and return the best individual
+func (b *Benchmark) Run() *evolve.Individual {
+	if b.Islands == 0 {
+		e := evolve.New(b.Config, b.Objective)
+		e.Mutation = Mutation()
+		return e.Run()
+	}
+	is := evolve.NewIslands(b.Islands, b.Config, b.Objective)
+	for _, e := range is.Engines {
+		e.Mutation = Mutation()
+	}
+	return is.Run()
+}
+
+// The solution, serialized for the virtual machine m
+func (b *Benchmark) Genome(m *vm.VirtualMachine) ([]byte, error) {
+	p := m.NewProgram()
+	if err := p.UnmarshalText([]byte(b.Solution)); err != nil {
+		return nil, err
+	}
+	return p.MarshalBinary()
+}
+
+// The benchmarks that are solved by their reference configurations
+func Suite() []*Benchmark {
+	return []*Benchmark{
+		Store42(),
+		Increment(),
+		Quartic(),
+		Koza1(),
+		EvenParity(2),
+		Multiplexer(1),
+		SumOfArray(2),
+		MaxOfTwo(),
+		Counting(8),
+	}
+}
+
+func Get(name string) (*Benchmark, error) {
+	for _, b := range Suite() {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown problem %q", name)
+}
+
+// A configuration with room for the solution in memory
+func config(name string, memory int, generations int) evolve.Config {
+	c := evolve.DefaultConfig()
+	c.Problem = name
+	c.VM.MemorySize = uint32(memory)
+	c.Generations = generations
+	return c
+}
+
+// A configuration for problems that need lookup tables
+func hard(name string, memory int) evolve.Config {
+	c := config(name, memory, 500)
+	c.PopulationSize = 200
+	c.InitialLength = 4
+	return c
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package problems
+
+import (
+	"Aldcran/MergePrograms"
+	"Aldcran/VirtualMachine"
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestSolutions(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// Larger instances than in Suite, which need longer lookup tables
+	for _, b := range append(Suite(), EvenParity(3), Multiplexer(2), SumOfArray(3)) {
+		m := vm.NewFromConfig(b.Config.VM)
+		g, err := b.Genome(m)
+		if err != nil {
+			t.Fatal(b.Name, err)
+		}
+		m.Reset()
+		if res := b.Objective.Evaluate(m, g); res.Fitness != 0 {
+			t.Error(b.Name, "expected a perfect solution, got", res)
+		}
+		if merged := merge.RandomMergeUnits(g, g, vm.InstructionSize, r); !bytes.Equal(merged, g) {
+			t.Error(b.Name, "expected merge with itself to give the same program")
+		}
+	}
+}
+
+// A regression test, the reference configurations shall solve the benchmarks
+func TestReference(t *testing.T) {
+	for _, b := range Suite() {
+		if best := b.Run(); best.Result.Fitness != 0 {
+			t.Error(b.Name, "expected a solution, got fitness", best.Result.Fitness)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	for _, name := range []string{"increment", "parity2"} {
+		if b, err := Get(name); err != nil || b.Name != name {
+			t.Error("Expected", name, "got", b, err)
+		}
+	}
+	if _, err := Get("unknown"); err == nil {
+		t.Error("Expected error for unknown problem")
+	}
+}
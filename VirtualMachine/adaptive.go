@@ -0,0 +1,184 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// Adaptation of mutation rates during a run. Either every program carries its own
+// rates, that are mutated log-normally as in evolution strategies, or one rate is
+// adapted for the whole population using the 1/5th success rule.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Mutation rate genes of a program
+type Rates struct {
+	Bit        float64 `json:"bit"`        // Bit flip probability per byte of the serialized program
+	Structural float64 `json:"structural"` // Scaling of the probabilities in SelfAdaptive.Structural
+}
+
+// Mutation where the rates are taken from the program itself. The rates are mutated
+// before they are used. A program without rates gets Initial.
+type SelfAdaptive struct {
+	Initial    Rates
+	Structural StructuralMutation
+	Min, Max   Rates   // Limits of every gene. Zero means 1e-5 for Min, and 1 for Bit and 10 for Structural in Max.
+	Tau        float64 // Learning rate of the individual genes. Default is 1/sqrt(2*sqrt(n)).
+	TauCommon  float64 // Learning rate of the common factor. Default is 1/sqrt(2*n).
+}
+
+// Number of genes in Rates
+const numRates = 2
+
+// Number of bytes in the binary encoding of Rates
+const RatesSize = 8 * numRates
+
+// Default upper limit of Rates.Structural, which scales probabilities that are usually small
+const maxStructuralScale = 10
+
+// Population level adaptation of a rate. If more than 1/5 of the mutations are
+// successful, the rate is increased, otherwise it is decreased. The counters are
+// exported to be saved in checkpoints.
+type SuccessRule struct {
+	Rate      float64
+	Factor    float64 // The rate is multiplied or divided by this. Default is 0.85.
+	Period    int     // Number of trials between every adaptation. Default is 10.
+	Min, Max  float64 // Limits of the rate. Default is 1e-5 and 1.
+	Successes int     // Successful trials since the last adaptation
+	Trials    int
+}
+
+// The rates are not part of the genome, as they shall not be changed by bit mutation or
+// merged as instructions. This encoding is used to store them next to the genome.
+func (r Rates) MarshalBinary() ([]byte, error) {
+	data := binary.LittleEndian.AppendUint64(nil, math.Float64bits(r.Bit))
+	return binary.LittleEndian.AppendUint64(data, math.Float64bits(r.Structural)), nil
+}
+
+func (r *Rates) UnmarshalBinary(data []byte) error {
+	if len(data) != RatesSize {
+		return fmt.Errorf("vm: rates length %d is not %d", len(data), RatesSize)
+	}
+	r.Bit = math.Float64frombits(binary.LittleEndian.Uint64(data))
+	r.Structural = math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))
+	return nil
+}
+
+func (p *program) Rates() *Rates {
+	return p.rates
+}
+
+func (p *program) SetRates(r *Rates) {
+	p.rates = r
+}
+
+func (m *SelfAdaptive) Apply(p *program, r *rand.Rand) bool {
+	if p.rates == nil {
+		initial := m.Initial
+		p.rates = &initial
+	}
+	m.adapt(p.rates, r)
+	structural := m.Structural
+	scale := float32(p.rates.Structural)
+	structural.Insert *= scale
+	structural.InsertNoop *= scale
+	structural.Delete *= scale
+	structural.Duplicate *= scale
+	structural.Swap *= scale
+	structural.Move *= scale
+	changed := structural.Apply(p, r)
+	if (BitMutation{Prob: float32(p.rates.Bit)}).Apply(p, r) {
+		changed = true
+	}
+	return changed
+}
+
+// Log-normal mutation of the rates
+func (m *SelfAdaptive) adapt(rates *Rates, r *rand.Rand) {
+	tau, tauCommon := m.Tau, m.TauCommon
+	if tau == 0 {
+		tau = 1 / math.Sqrt(2*math.Sqrt(numRates))
+	}
+	if tauCommon == 0 {
+		tauCommon = 1 / math.Sqrt(2*numRates)
+	}
+	common := tauCommon * r.NormFloat64()
+	maxStructural := m.Max.Structural
+	if maxStructural == 0 {
+		maxStructural = maxStructuralScale
+	}
+	rates.Bit = limit(rates.Bit*math.Exp(common+tau*r.NormFloat64()), m.Min.Bit, m.Max.Bit)
+	rates.Structural = limit(rates.Structural*math.Exp(common+tau*r.NormFloat64()), m.Min.Structural, maxStructural)
+}
+
+// Rates of a child from two parents, using the geometric mean. A parent without rates is ignored.
+func InheritRates(a, b *Rates) *Rates {
+	if a == nil || b == nil {
+		if a == nil {
+			a = b
+		}
+		if a == nil {
+			return nil
+		}
+		child := *a
+		return &child
+	}
+	return &Rates{
+		Bit:        math.Sqrt(a.Bit * b.Bit),
+		Structural: math.Sqrt(a.Structural * b.Structural),
+	}
+}
+
+// Record the result of a mutation. A success is a mutation that gave better fitness than the parent.
+func (s *SuccessRule) Record(success bool) {
+	s.Trials++
+	if success {
+		s.Successes++
+	}
+	period := s.Period
+	if period == 0 {
+		period = 10
+	}
+	if s.Trials < period {
+		return
+	}
+	factor := s.Factor
+	if factor == 0 {
+		factor = 0.85
+	}
+	ratio := float64(s.Successes) / float64(s.Trials)
+	if ratio > 0.2 {
+		s.Rate = limit(s.Rate/factor, s.Min, s.Max)
+	} else if ratio < 0.2 {
+		s.Rate = limit(s.Rate*factor, s.Min, s.Max)
+	}
+	s.Successes, s.Trials = 0, 0
+}
+
+// Limit v to [min, max], where a 0 limit means the default
+func limit(v, min, max float64) float64 {
+	if min == 0 {
+		min = 1e-5
+	}
+	if max == 0 {
+		max = 1
+	}
+	return math.Min(math.Max(v, min), max)
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSelfAdaptive(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	m := SelfAdaptive{Initial: Rates{Bit: 0.01, Structural: 1}, Structural: StructuralMutation{Insert: 0.1}, Max: Rates{Bit: 0.5, Structural: 2}}
+	p := numberedProgram(10)
+	m.Apply(p, r)
+	if p.rates == nil {
+		t.Fatal("Expected the program to get rates")
+	}
+	first := *p.rates
+	if first == m.Initial {
+		t.Error("Expected the rates to be mutated")
+	}
+	for i := 0; i < 1000; i++ {
+		m.Apply(p, r)
+		if p.rates.Bit < 1e-5 || p.rates.Bit > 0.5 || p.rates.Structural < 1e-5 || p.rates.Structural > 2 {
+			t.Fatal("Rates out of limits:", *p.rates)
+		}
+	}
+	if m.Initial.Bit != 0.01 {
+		t.Error("The initial rates shall not change")
+	}
+}
+
+// Every gene has its own default limits
+func TestSelfAdaptiveLimits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var m SelfAdaptive
+	rates := Rates{Bit: 0.5, Structural: 5}
+	for i := 0; i < 1000; i++ {
+		m.adapt(&rates, r)
+		if rates.Bit > 1 || rates.Structural > maxStructuralScale {
+			t.Fatal("Rates out of limits:", rates)
+		}
+	}
+	rates = Rates{Bit: 1, Structural: 1}
+	m.Tau, m.TauCommon = 1e-9, 5 // Both genes move up together
+	for i := 0; i < 100; i++ {
+		m.adapt(&rates, r)
+		if rates.Structural > 1 {
+			return
+		}
+	}
+	t.Error("Structural never exceeded 1")
+}
+
+func TestInheritRates(t *testing.T) {
+	a := &Rates{Bit: 0.01, Structural: 4}
+	b := &Rates{Bit: 0.04, Structural: 1}
+	c := InheritRates(a, b)
+	if math.Abs(c.Bit-0.02) > 1e-9 || math.Abs(c.Structural-2) > 1e-9 {
+		t.Error("Expected geometric mean, got", *c)
+	}
+	if c := InheritRates(nil, b); c == b || *c != *b {
+		t.Error("Expected a copy of the only parent rates, got", c)
+	}
+	if InheritRates(nil, nil) != nil {
+		t.Error("Expected no rates without parent rates")
+	}
+}
+
+func TestSuccessRule(t *testing.T) {
+	s := SuccessRule{Rate: 0.1, Period: 5}
+	for i := 0; i < 5; i++ {
+		s.Record(true)
+	}
+	if s.Rate <= 0.1 {
+		t.Error("Expected the rate to increase, got", s.Rate)
+	}
+	rate := s.Rate
+	for i := 0; i < 5; i++ {
+		s.Record(i == 0) // Exactly 1/5
+	}
+	if s.Rate != rate {
+		t.Error("Expected the rate to be unchanged, got", s.Rate)
+	}
+	for i := 0; i < 5; i++ {
+		s.Record(false)
+	}
+	if s.Rate >= rate {
+		t.Error("Expected the rate to decrease, got", s.Rate)
+	}
+}
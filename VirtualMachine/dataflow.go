@@ -0,0 +1,159 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// Static data flow of a program. The def-use graph has an edge from every instruction
+// that stores to a memory cell, to the later instructions that read the cell. Stores
+// through storeIndirect depend on the memory at run time, so their targets are unknown,
+// and they get an edge to every later read that they may reach.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+type Edge struct {
+	From, To int   // Instruction indices. From is -1 for the initial memory, and To is -1 for the output.
+	Cell     int   // The memory cell
+	Field    Field // How the cell is read, FieldAddIndirect, FieldMultIndirect or FieldStoreIndirect. NumFields for the output.
+	Unknown  bool  // From is a store through storeIndirect, which may not write to Cell
+}
+
+type Graph struct {
+	Layout       Layout
+	Instructions []instruction
+	Edges        []Edge
+}
+
+// Build the def-use graph. The output cells of the layout get an edge to the output.
+func (p *program) DefUse(l Layout) *Graph {
+	memory := len(p.virtualMachine.memory)
+	address := func(addr int) bool { // 0 means that the field is not used
+		return addr > 0 && addr < memory
+	}
+	g := &Graph{Layout: l, Instructions: append([]instruction(nil), p.instructions...)}
+	lastDef := make([]int, memory)
+	for i := range lastDef {
+		lastDef[i] = -1
+	}
+	var indirect []int // Instructions that store through storeIndirect, in order
+	use := func(to, cell int, f Field) {
+		g.Edges = append(g.Edges, Edge{From: lastDef[cell], To: to, Cell: cell, Field: f})
+		for _, from := range indirect {
+			if from > lastDef[cell] && from != to {
+				g.Edges = append(g.Edges, Edge{From: from, To: to, Cell: cell, Field: f, Unknown: true})
+			}
+		}
+	}
+	// The order is the same as in execute
+	for pc, ins := range p.instructions {
+		if address(ins.multIndirect) {
+			use(pc, ins.multIndirect, FieldMultIndirect)
+		}
+		if address(ins.addIndirect) {
+			use(pc, ins.addIndirect, FieldAddIndirect)
+		}
+		if address(ins.storeAddress) {
+			lastDef[ins.storeAddress] = pc
+		}
+		if address(ins.storeIndirect) {
+			use(pc, ins.storeIndirect, FieldStoreIndirect)
+			indirect = append(indirect, pc)
+		}
+	}
+	for _, cell := range l.Output {
+		if cell >= 0 && cell < memory {
+			use(-1, cell, NumFields)
+		}
+	}
+	return g
+}
+
+// The assembly syntax of a read
+func (e *Edge) label() string {
+	var s string
+	switch e.Field {
+	case FieldMultIndirect:
+		s = fmt.Sprintf("*mem[%d]", e.Cell)
+	case FieldAddIndirect:
+		s = fmt.Sprintf("+mem[%d]", e.Cell)
+	case FieldStoreIndirect:
+		s = fmt.Sprintf("store[*%d]", e.Cell)
+	default:
+		s = fmt.Sprintf("mem[%d]", e.Cell)
+	}
+	if e.Unknown {
+		s += "?"
+	}
+	return s
+}
+
+// Write the graph in the Graphviz DOT format. Instructions with an indirect store are
+// red, and edges from unknown targets are dashed.
+func (g *Graph) WriteDot(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph program {")
+	fmt.Fprintln(b, "\tnode [shape=box];")
+	for pc, ins := range g.Instructions {
+		attr := ""
+		if ins.storeIndirect != 0 {
+			attr = ", color=red"
+		}
+		fmt.Fprintf(b, "\ti%d [label=%q%s];\n", pc, fmt.Sprintf("%d: %v", pc, &ins), attr)
+	}
+	initial := make(map[int]bool)
+	for _, e := range g.Edges {
+		if e.From == -1 && !initial[e.Cell] {
+			initial[e.Cell] = true
+			label := fmt.Sprintf("mem[%d]", e.Cell)
+			for _, in := range g.Layout.Input {
+				if in == e.Cell {
+					label = "in " + label
+					break
+				}
+			}
+			fmt.Fprintf(b, "\tm%d [label=%q, shape=ellipse];\n", e.Cell, label)
+		}
+	}
+	// Only the outputs that DefUse found in memory
+	output := make(map[int]bool)
+	for _, e := range g.Edges {
+		if e.To == -1 && !output[e.Cell] {
+			output[e.Cell] = true
+			fmt.Fprintf(b, "\to%d [label=%q, shape=ellipse];\n", e.Cell, fmt.Sprintf("out mem[%d]", e.Cell))
+		}
+	}
+	for _, e := range g.Edges {
+		from := fmt.Sprintf("i%d", e.From)
+		if e.From == -1 {
+			from = fmt.Sprintf("m%d", e.Cell)
+		}
+		to := fmt.Sprintf("i%d", e.To)
+		if e.To == -1 {
+			to = fmt.Sprintf("o%d", e.Cell)
+		}
+		style := ""
+		if e.Unknown {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(b, "\t%s -> %s [label=%q%s];\n", from, to, e.label(), style)
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDefUse(t *testing.T) {
+	m := New(16, 10)
+	p := m.NewProgram()
+	p.instructions = []instruction{
+		{addImmediate: 1, addIndirect: 1, storeAddress: 5}, // Reads the input
+		{addImmediate: 3, storeIndirect: 4},                // Unknown target
+		{addIndirect: 5, multIndirect: 6, storeAddress: 2}, // Output
+		{addImmediate: 9, storeAddress: 5},                 // Never read
+	}
+	g := p.DefUse(Layout{Input: []int{1}, Output: []int{2}})
+	expected := []Edge{
+		{From: -1, To: 0, Cell: 1, Field: FieldAddIndirect},
+		{From: -1, To: 1, Cell: 4, Field: FieldStoreIndirect},
+		{From: -1, To: 2, Cell: 6, Field: FieldMultIndirect},
+		{From: 1, To: 2, Cell: 6, Field: FieldMultIndirect, Unknown: true},
+		{From: 0, To: 2, Cell: 5, Field: FieldAddIndirect},
+		{From: 1, To: 2, Cell: 5, Field: FieldAddIndirect, Unknown: true},
+		{From: 2, To: -1, Cell: 2, Field: NumFields}, // The unknown store is overwritten
+	}
+	if len(g.Edges) != len(expected) {
+		t.Fatal("Expected", expected, "got", g.Edges)
+	}
+	for i := range expected {
+		if g.Edges[i] != expected[i] {
+			t.Error("Edge", i, "expected", expected[i], "got", g.Edges[i])
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteDot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	for _, s := range []string{
+		"digraph program {",
+		`i1 [label="1: +3, store[*4], ", color=red];`,
+		`m1 [label="in mem[1]", shape=ellipse];`,
+		`o2 [label="out mem[2]", shape=ellipse];`,
+		`i0 -> i2 [label="+mem[5]"];`,
+		`i1 -> i2 [label="+mem[5]?", style=dashed];`,
+		`i2 -> o2 [label="mem[2]"];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Error("Expected", s, "in", dot)
+		}
+	}
+}
+
+// Outputs outside of memory have no node, and a repeated input cell is labelled once
+func TestWriteDotLayout(t *testing.T) {
+	m := New(16, 4)
+	p := m.NewProgram()
+	p.instructions = []instruction{{addIndirect: 1, storeAddress: 2}}
+	var buf bytes.Buffer
+	if err := p.DefUse(Layout{Input: []int{1, 1}, Output: []int{2, 2, 9}}).WriteDot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+	if strings.Contains(dot, "o9") || strings.Count(dot, "\to2 [") != 1 {
+		t.Error("Expected one output node for mem[2], got", dot)
+	}
+	if !strings.Contains(dot, `m1 [label="in mem[1]"`) {
+		t.Error("Expected the input label once, got", dot)
+	}
+}
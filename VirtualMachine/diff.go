@@ -0,0 +1,167 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// A listing of the differences between two programs, in the style of a unified diff.
+// Whole instructions are aligned with the diff algorithm of MergePrograms. Lines are
+// prefixed with " " for unchanged instructions, "-" and "+" for removed and added, and
+// "~" for an instruction that was replaced by another. Changed fields of replaced
+// instructions are shown as {old => new}. Instructions are numbered from 0.
+
+import (
+	"Aldcran/MergePrograms"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type diffLine struct {
+	kind byte
+	a, b int // Instruction indices, -1 if not used
+}
+
+// Align the instructions of a and b. A run of changes between equal instructions is
+// shown as replaced instructions, as far as possible.
+func diffLines(a, b *program) []diffLine {
+	da, _ := a.MarshalBinary()
+	db, _ := b.MarshalBinary()
+	var lines []diffLine
+	var deleted, inserted []int
+	flush := func() {
+		n := len(deleted)
+		if len(inserted) < n {
+			n = len(inserted)
+		}
+		for i := 0; i < n; i++ {
+			lines = append(lines, diffLine{kind: '~', a: deleted[i], b: inserted[i]})
+		}
+		for _, x := range deleted[n:] {
+			lines = append(lines, diffLine{kind: '-', a: x, b: -1})
+		}
+		for _, y := range inserted[n:] {
+			lines = append(lines, diffLine{kind: '+', a: -1, b: y})
+		}
+		deleted, inserted = nil, nil
+	}
+	for _, c := range merge.Diff(da, db, InstructionSize) {
+		switch c.Op {
+		case merge.Equal:
+			flush()
+			lines = append(lines, diffLine{kind: ' ', a: c.A, b: c.B})
+		case merge.Delete:
+			deleted = append(deleted, c.A)
+		case merge.Insert:
+			inserted = append(inserted, c.B)
+		}
+	}
+	flush()
+	return lines
+}
+
+// Show the fields that differ as {old => new}. Fields that differ without changing the
+// pretty string, like a clear below the threshold, are shown with their values.
+func highlight(a, b *instruction) string {
+	var parts []string
+	for _, f := range displayOrder {
+		fa, fb := a.fragment(f), b.fragment(f)
+		switch {
+		case *a.field(f) == *b.field(f):
+			if fa != "" {
+				parts = append(parts, fa)
+			}
+		case fa == fb:
+			parts = append(parts, fmt.Sprintf("{%s=%d => %d}", f, *a.field(f), *b.field(f)))
+		default:
+			if fa == "" {
+				fa = "_"
+			}
+			if fb == "" {
+				fb = "_"
+			}
+			parts = append(parts, fmt.Sprintf("{%s => %s}", fa, fb))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Write the differences from a to b, with context unchanged instructions around every
+// change. Nothing is written if the programs are equal.
+func WriteDiff(w io.Writer, nameA string, a *program, nameB string, b *program, context int) error {
+	lines := diffLines(a, b)
+	// Positions in a and b before every line, used for the hunk headers
+	posA, posB := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, l := range lines {
+		posA[i+1], posB[i+1] = posA[i], posB[i]
+		if l.a >= 0 {
+			posA[i+1]++
+		}
+		if l.b >= 0 {
+			posB[i+1]++
+		}
+	}
+	out := bufio.NewWriter(w)
+	header := false
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			start++
+			continue
+		}
+		// A hunk from the first change, until there are more than 2*context equal lines
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for equal := 0; end < len(lines) && equal <= 2*context; end++ {
+			if lines[end].kind == ' ' {
+				equal++
+			} else {
+				equal = 0
+			}
+		}
+		// Remove trailing equal lines beyond the context
+		last := end
+		for last > start && lines[last-1].kind == ' ' {
+			last--
+		}
+		last += context
+		if last > len(lines) {
+			last = len(lines)
+		}
+		if !header {
+			fmt.Fprintf(out, "--- %s\n+++ %s\n", nameA, nameB)
+			header = true
+		}
+		fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", posA[first], posA[last]-posA[first], posB[first], posB[last]-posB[first])
+		for _, l := range lines[first:last] {
+			switch l.kind {
+			case ' ':
+				fmt.Fprintf(out, "  %d: %v\n", l.a, &a.instructions[l.a])
+			case '-':
+				fmt.Fprintf(out, "- %d: %v\n", l.a, &a.instructions[l.a])
+			case '+':
+				fmt.Fprintf(out, "+ %d: %v\n", l.b, &b.instructions[l.b])
+			case '~':
+				fmt.Fprintf(out, "~ %d: %s\n", l.a, highlight(&a.instructions[l.a], &b.instructions[l.b]))
+			}
+		}
+		start = last
+	}
+	return out.Flush()
+}
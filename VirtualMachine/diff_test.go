@@ -0,0 +1,58 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteDiff(t *testing.T) {
+	a := numberedProgram(6)
+	b := numberedProgram(7)
+	b.instructions[1] = instruction{clear: 10, addImmediate: 5, storeAddress: 3}
+	b.instructions[6] = instruction{addIndirect: 2, storeIndirect: 4}
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, "parent", a, "child", b, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := `--- parent
++++ child
+@@ -0,3 +0,3 @@
+  0: +1, 
+~ 1: {clear=0 => 10}, {+2 => +5}, {_ => store[3]}
+  2: +3, 
+@@ -5,1 +5,2 @@
+  5: +6, 
++ 6: +mem[2], store[*4], 
+`
+	if buf.String() != expected {
+		t.Error("Expected\n" + expected + "got\n" + buf.String())
+	}
+
+	buf.Reset()
+	WriteDiff(&buf, "a", a, "b", a, 3)
+	if buf.Len() != 0 {
+		t.Error("Expected no output for equal programs, got", buf.String())
+	}
+	buf.Reset()
+	WriteDiff(&buf, "a", a, "b", b, 3)
+	if bytes.Count(buf.Bytes(), []byte("@@")) != 2 {
+		t.Error("Expected one hunk with more context, got", buf.String())
+	}
+}
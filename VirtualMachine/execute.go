@@ -27,6 +27,12 @@ const (
 	parPenaltyStoreIndirIllegalAddress = 100
 )
 
+// Memory addresses used for the input and output of a program
+type Layout struct {
+	Input  []int
+	Output []int
+}
+
 // Run a program, and return the number of instructions that were executed
 func (p *program) run() (cost int) {
 	for pc := 0; pc < len(p.instructions); pc++ {
@@ -36,6 +42,26 @@ func (p *program) run() (cost int) {
 	return
 }
 
+// Load the input into memory, run the program and read the output. The memory is not
+// cleared first, use VirtualMachine.Reset for that. Addresses outside of the memory are ignored.
+func (p *program) Call(l Layout, input []int) (output []int, penalties int, cost int) {
+	memory := p.virtualMachine.memory
+	for i, addr := range l.Input {
+		if i < len(input) && addr >= 0 && addr < len(memory) {
+			memory[addr] = input[i]
+		}
+	}
+	before := p.penalties
+	cost = p.run()
+	output = make([]int, len(l.Output))
+	for i, addr := range l.Output {
+		if addr >= 0 && addr < len(memory) {
+			output[i] = memory[addr]
+		}
+	}
+	return output, p.penalties - before, cost
+}
+
 func (i *instruction) execute(p *program) {
 	memory := p.virtualMachine.memory
 	var value int
@@ -46,7 +72,7 @@ func (i *instruction) execute(p *program) {
 	// use a down scaled value added with 1 to minimize impact
 	value = int(float64(value)*(1+float64(i.multImmediate)/parMultScaling) + 0.5)
 	if ind := i.multIndirect; ind != 0 {
-		if int(ind) < len(memory) {
+		if valid(ind, memory) {
 			value = int(float64(value)*(1+float64(memory[ind])/parMultScaling) + 0.5)
 		} else {
 			p.addPenalty(parPenaltyMultIllegalAddress)
@@ -54,21 +80,21 @@ func (i *instruction) execute(p *program) {
 	}
 	value += i.addImmediate
 	if ind := i.addIndirect; ind != 0 {
-		if int(ind) < len(memory) {
+		if valid(ind, memory) {
 			value += memory[ind]
 		} else {
 			p.addPenalty(parPenaltyAddIllegalAddress)
 		}
 	}
 	if addr := i.storeAddress; addr != 0 {
-		if int(addr) < len(memory) {
+		if valid(addr, memory) {
 			memory[addr] = value
 		} else {
 			p.addPenalty(parPenaltyStoreIllegalAddress)
 		}
 	}
 	if ind := i.storeIndirect; ind != 0 {
-		if int(ind) < len(memory) && int(memory[ind]) < len(memory) {
+		if valid(ind, memory) && valid(memory[ind], memory) {
 			addr := memory[ind]
 			memory[addr] = value
 		} else {
@@ -77,6 +103,11 @@ func (i *instruction) execute(p *program) {
 	}
 }
 
+// Fields and memory values can be negative, and are then as illegal as too big addresses
+func valid(addr int, memory []int) bool {
+	return addr >= 0 && addr < len(memory)
+}
+
 func (p *program) addPenalty(penalty int) {
 	p.penalties += penalty
 }
@@ -36,6 +36,59 @@ type instruction struct {
 	storeIndirect int
 }
 
+// Identifies one of the fields in an instruction. The order is the same as used in the serialization.
+type Field int
+
+const (
+	FieldClear Field = iota
+	FieldAddImmediate
+	FieldAddIndirect
+	FieldMultImmediate
+	FieldMultIndirect
+	FieldStoreAddress
+	FieldStoreIndirect
+	NumFields
+)
+
+// The names are the same as the field names of the instruction struct
+var fieldNames = [NumFields]string{
+	"clear",
+	"addImmediate",
+	"addIndirect",
+	"multImmediate",
+	"multIndirect",
+	"storeAddress",
+	"storeIndirect",
+}
+
+func (f Field) String() string {
+	if f < 0 || f >= NumFields {
+		return fmt.Sprintf("Field(%d)", int(f))
+	}
+	return fieldNames[f]
+}
+
+// Get a pointer to a field in the instruction
+func (i *instruction) field(f Field) *int {
+	switch f {
+	case FieldClear:
+		return &i.clear
+	case FieldAddImmediate:
+		return &i.addImmediate
+	case FieldAddIndirect:
+		return &i.addIndirect
+	case FieldMultImmediate:
+		return &i.multImmediate
+	case FieldMultIndirect:
+		return &i.multIndirect
+	case FieldStoreAddress:
+		return &i.storeAddress
+	case FieldStoreIndirect:
+		return &i.storeIndirect
+	}
+	return nil
+}
+
 var noop = instruction{
 	clear:         0,
 	addImmediate:  0,
@@ -52,11 +105,7 @@ type program struct {
 	// This will be used to evaluate the success/failure indicator of the algorithm
 	penalties      int
 	virtualMachine *VirtualMachine
-}
-
-type subroutine struct {
-	id uint32 // Identifying the subroutine
-	pr program
+	rates          *Rates // Mutation rate genes, only used in self adaptive mode
 }
 
 func main() {
@@ -20,16 +20,20 @@ package vm
 import (
 	"fmt"
 	"github.com/larspensjo/go-monotonic-graycode"
+	"math/rand"
 )
 
 type VirtualMachine struct {
 	graycode *mgc.Mgc
+	width    uint32 // Number of bits used by the graycode
 	memory   []int
+	library  *Library // Subroutines used by RandomProgram and LibraryInsert
 }
 
 func New(width uint32, memorySize uint32) *VirtualMachine {
 	var vm VirtualMachine
 	vm.graycode = mgc.New(width)
+	vm.width = width
 	vm.memory = make([]int, memorySize)
 	return &vm
 }
@@ -42,36 +46,96 @@ func (vm *VirtualMachine) NewProgram() *program {
 	return &p
 }
 
-// Convert an instruction to a pretty string
-func (i *instruction) String() (ret string) {
-	if i.clear > parClearThreshold {
-		ret = "Clear, "
-	}
-	if i.multImmediate != 0 {
-		ret += fmt.Sprintf("*%d, ", i.multImmediate)
-	}
-	if ind := i.multIndirect; ind != 0 {
-		ret += fmt.Sprintf("*mem[%d], ", ind)
-	}
-	if i.addImmediate != 0 {
-		ret += fmt.Sprintf("+%d, ", i.addImmediate)
-	}
-	if ind := i.addIndirect; ind != 0 {
-		ret += fmt.Sprintf("+mem[%d], ", ind)
+// Create a program with n random instructions. With a library, a subroutine is also
+// inlined in the fraction Library.Init of the programs.
+func (vm *VirtualMachine) RandomProgram(n int, r *rand.Rand) *program {
+	p := vm.NewProgram()
+	for i := 0; i < n; i++ {
+		p.instructions = append(p.instructions, randomInstruction(r, len(vm.memory)))
 	}
-	if addr := i.storeAddress; addr != 0 {
-		ret += fmt.Sprintf("store[%d], ", addr)
+	if vm.library != nil && vm.library.Init > 0 && r.Float64() < vm.library.Init {
+		p.inline(vm.library, r, 0)
 	}
-	if ind := i.storeIndirect; ind != 0 {
-		ret += fmt.Sprintf("store[*%d], ", ind)
+	return p
+}
+
+// Clear the memory
+func (vm *VirtualMachine) Reset() {
+	for i := range vm.memory {
+		vm.memory[i] = 0
 	}
+}
+
+// The memory of the virtual machine. It is shared by all programs using it.
+func (vm *VirtualMachine) Memory() []int {
+	return vm.memory
+}
+
+// Run the program, and return the number of instructions that were executed
+func (p *program) Run() int {
+	return p.run()
+}
+
+func (p *program) Penalties() int {
+	return p.penalties
+}
 
+// Number of instructions
+func (p *program) Len() int {
+	return len(p.instructions)
+}
+
+// Convert an instruction to a pretty string
+func (i *instruction) String() (ret string) {
+	for _, f := range displayOrder {
+		if s := i.fragment(f); s != "" {
+			ret += s + ", "
+		}
+	}
 	if ret == "" {
 		ret = "noop"
 	}
 	return
 }
 
+// The order of the fields in the pretty string
+var displayOrder = []Field{FieldClear, FieldMultImmediate, FieldMultIndirect, FieldAddImmediate, FieldAddIndirect, FieldStoreAddress, FieldStoreIndirect}
+
+// The pretty string of one field, empty if the field is not used
+func (i *instruction) fragment(f Field) string {
+	switch f {
+	case FieldClear:
+		if i.clear > parClearThreshold {
+			return "Clear"
+		}
+	case FieldMultImmediate:
+		if i.multImmediate != 0 {
+			return fmt.Sprintf("*%d", i.multImmediate)
+		}
+	case FieldMultIndirect:
+		if ind := i.multIndirect; ind != 0 {
+			return fmt.Sprintf("*mem[%d]", ind)
+		}
+	case FieldAddImmediate:
+		if i.addImmediate != 0 {
+			return fmt.Sprintf("+%d", i.addImmediate)
+		}
+	case FieldAddIndirect:
+		if ind := i.addIndirect; ind != 0 {
+			return fmt.Sprintf("+mem[%d]", ind)
+		}
+	case FieldStoreAddress:
+		if addr := i.storeAddress; addr != 0 {
+			return fmt.Sprintf("store[%d]", addr)
+		}
+	case FieldStoreIndirect:
+		if ind := i.storeIndirect; ind != 0 {
+			return fmt.Sprintf("store[*%d]", ind)
+		}
+	}
+	return ""
+}
+
 func (p *program) String() (ret string) {
 	for i, ins := range p.instructions {
 		ret += fmt.Sprintln(i, ": ", ins.String())
@@ -56,3 +56,40 @@ func TestAdd(t *testing.T) {
 		t.Error("addimmediate should give 1, but had", p.virtualMachine.memory[1])
 	}
 }
+
+func TestCall(t *testing.T) {
+	vm := New(16, 10)
+	p := vm.NewProgram()
+	p.instructions = []instruction{{addImmediate: 5, addIndirect: 1, storeAddress: 2}, {addIndirect: 2, storeAddress: 20}}
+	l := Layout{Input: []int{1}, Output: []int{2, 30}}
+	output, penalties, cost := p.Call(l, []int{3})
+	if output[0] != 8 || output[1] != 0 {
+		t.Error("Expected output [8 0], got", output)
+	}
+	if penalties != parPenaltyStoreIllegalAddress || cost != 2 {
+		t.Error("Expected penalty", parPenaltyStoreIllegalAddress, "and cost 2, got", penalties, cost)
+	}
+	output, penalties, _ = p.Call(l, []int{4})
+	if output[0] != 9 || penalties != parPenaltyStoreIllegalAddress {
+		t.Error("Expected only the penalties from the last call, got", penalties)
+	}
+	vm.Reset()
+	if vm.Memory()[2] != 0 {
+		t.Error("Expected memory to be cleared")
+	}
+}
+
+func TestNegativeAddress(t *testing.T) {
+	var p program
+	p.virtualMachine = New(16, 4)
+	p.instructions = []instruction{
+		{addImmediate: -3, storeAddress: 2},
+		{addImmediate: 5, storeIndirect: 2}, // Store to address -3
+		{addIndirect: -1, multIndirect: -2, storeAddress: -1},
+	}
+	p.run()
+	expected := parPenaltyStoreIndirIllegalAddress + parPenaltyAddIllegalAddress + parPenaltyMultIllegalAddress + parPenaltyStoreIllegalAddress
+	if p.penalties != expected {
+		t.Error("Expected penalty", expected, "got", p.penalties)
+	}
+}
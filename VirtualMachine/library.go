@@ -0,0 +1,178 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// A library of subroutines, which are programs that solved earlier problems. The idea is
+// to start with easy problems, and let later problems reuse the results. There is no
+// call instruction, so subroutines are always inlined as copies.
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type Subroutine struct {
+	Id           uint64        `json:"id"`
+	Problem      string        `json:"problem"` // The problem it was found for
+	Fitness      float64       `json:"fitness"`
+	Usage        int           `json:"usage"` // Number of times it has been inlined
+	Created      time.Time     `json:"created"`
+	Instructions []instruction `json:"instructions"`
+}
+
+// The library is shared by all programs of a virtual machine. It is safe to use from
+// several virtual machines in parallel, as long as it is only changed by its methods.
+type Library struct {
+	Subroutines []*Subroutine `json:"subroutines"`
+	Init        float64       `json:"-"` // The fraction of random programs that get an inlined subroutine
+	mutex       sync.Mutex
+}
+
+// Inline a random subroutine at a random position of a program
+type LibraryInsert struct {
+	Prob      float32
+	MaxLength int // Programs will not grow beyond this length. 0 means no limit.
+}
+
+func LoadLibrary(name string) (*Library, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return UnmarshalLibrary(data)
+}
+
+// Create a library from the JSON of MarshalJSON
+func UnmarshalLibrary(data []byte) (*Library, error) {
+	var l Library
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// The subroutines, including the usage counts. Init is not included.
+func (l *Library) MarshalJSON() ([]byte, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	type plain struct {
+		Subroutines []*Subroutine `json:"subroutines"`
+	}
+	return json.Marshal(plain{l.Subroutines})
+}
+
+// Save the library, by writing a new file that replaces the old
+func (l *Library) Save(name string) error {
+	data, err := json.MarshalIndent(l, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Add a copy of a program to the library
+func (l *Library) Add(p *program, problem string, fitness float64) *Subroutine {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var id uint64
+	for _, s := range l.Subroutines {
+		if s.Id > id {
+			id = s.Id
+		}
+	}
+	s := &Subroutine{
+		Id:           id + 1,
+		Problem:      problem,
+		Fitness:      fitness,
+		Created:      time.Now().UTC(),
+		Instructions: append([]instruction(nil), p.instructions...),
+	}
+	l.Subroutines = append(l.Subroutines, s)
+	return s
+}
+
+func (l *Library) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.Subroutines)
+}
+
+// Choose a random subroutine. If it has at most max instructions, or max is negative, the
+// usage is counted and a copy of the instructions is returned. Otherwise, or if the library
+// is empty, it returns nil.
+func (l *Library) draw(r *rand.Rand, max int) []instruction {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.Subroutines) == 0 {
+		return nil
+	}
+	s := l.Subroutines[r.Intn(len(l.Subroutines))]
+	if max >= 0 && len(s.Instructions) > max {
+		return nil
+	}
+	s.Usage++
+	return append([]instruction(nil), s.Instructions...)
+}
+
+// Use the library for random programs and LibraryInsert
+func (vm *VirtualMachine) SetLibrary(l *Library) {
+	vm.library = l
+}
+
+func (vm *VirtualMachine) Library() *Library {
+	return vm.library
+}
+
+func (m LibraryInsert) Apply(p *program, r *rand.Rand) bool {
+	l := p.virtualMachine.library
+	if l == nil || r.Float32() >= m.Prob {
+		return false
+	}
+	return p.inline(l, r, m.MaxLength)
+}
+
+// Insert a copy of a subroutine, if it fits within maxLength
+func (p *program) inline(l *Library, r *rand.Rand, maxLength int) bool {
+	room := -1
+	if maxLength > 0 {
+		room = maxLength - len(p.instructions)
+	}
+	code := l.draw(r, room)
+	if len(code) == 0 {
+		return false
+	}
+	p.insert(r.Intn(len(p.instructions)+1), code...)
+	return true
+}
@@ -0,0 +1,130 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestLibrary(t *testing.T) {
+	l := &Library{}
+	s1 := l.Add(numberedProgram(3), "first", 0)
+	s2 := l.Add(numberedProgram(2), "second", 1.5)
+	if s1.Id != 1 || s2.Id != 2 || l.Len() != 2 {
+		t.Fatal("Expected ids 1 and 2, got", s1.Id, s2.Id)
+	}
+	name := filepath.Join(t.TempDir(), "library.json")
+	if err := l.Save(name); err != nil {
+		t.Fatal(err)
+	}
+	l2, err := LoadLibrary(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2.Len() != 2 {
+		t.Fatal("Expected 2 subroutines, got", l2.Len())
+	}
+	got := l2.Subroutines[1]
+	if got.Problem != "second" || got.Fitness != 1.5 || !got.Created.Equal(s2.Created) || len(got.Instructions) != 2 {
+		t.Error("Expected", s2, "got", got)
+	}
+	if s := l2.Add(numberedProgram(1), "third", 0); s.Id != 3 {
+		t.Error("Expected id 3 after loading, got", s.Id)
+	}
+}
+
+func TestLibraryInsert(t *testing.T) {
+	m := New(16, 10)
+	l := &Library{}
+	l.Add(numberedProgram(3), "test", 0)
+	r := rand.New(rand.NewSource(1))
+	p := m.NewProgram()
+	if (LibraryInsert{Prob: 1}).Apply(p, r) {
+		t.Error("Expected no change without a library")
+	}
+	m.SetLibrary(l)
+	p.instructions = []instruction{noop}
+	if !(LibraryInsert{Prob: 1}).Apply(p, r) || len(p.instructions) != 4 {
+		t.Fatal("Expected an inlined copy of 3 instructions, got", p.instructions)
+	}
+	if l.Subroutines[0].Usage != 1 {
+		t.Error("Expected usage 1, got", l.Subroutines[0].Usage)
+	}
+	if (LibraryInsert{Prob: 1, MaxLength: 6}).Apply(p, r) {
+		t.Error("Expected no room for another copy")
+	}
+	if l.Subroutines[0].Usage != 1 {
+		t.Error("Expected a copy without room not to be counted, got usage", l.Subroutines[0].Usage)
+	}
+	p.instructions[0].addImmediate = 1000
+	if l.Subroutines[0].Instructions[0].addImmediate == 1000 {
+		t.Error("Expected a copy of the subroutine")
+	}
+
+	l.Init = 1
+	if p := m.RandomProgram(2, r); len(p.instructions) != 5 {
+		t.Error("Expected a random program with a subroutine, got", p.instructions)
+	}
+}
+
+// Inlining from several virtual machines in parallel shall not change the library, or
+// programs of other virtual machines. Run with -race to detect shared memory.
+func TestLibraryParallel(t *testing.T) {
+	l := &Library{}
+	p := numberedProgram(5)
+	l.Add(p, "parallel", 0)
+	// Spare capacity, which made insert write into the library
+	l.Subroutines[0].Instructions = append(make([]instruction, 0, 64), l.Subroutines[0].Instructions...)
+	expected := append([]instruction(nil), p.instructions...)
+	start, done := make(chan bool), make(chan bool)
+	for g := 0; g < 4; g++ {
+		go func(seed int64) {
+			defer func() { done <- true }()
+			<-start
+			m := New(16, 10)
+			m.SetLibrary(l)
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				q := m.NewProgram()
+				q.instructions = []instruction{{addImmediate: int(seed)}}
+				q.inline(l, r, 0)
+				start := 0
+				if q.instructions[0].addImmediate == int(seed) {
+					start = 1
+				}
+				for j, ins := range expected {
+					if q.instructions[start+j] != ins {
+						t.Error("Inlined code was changed:", q.instructions)
+						return
+					}
+				}
+			}
+		}(int64(g + 100))
+	}
+	close(start)
+	for g := 0; g < 4; g++ {
+		<-done
+	}
+	for i, ins := range l.Subroutines[0].Instructions {
+		if ins != expected[i] {
+			t.Fatal("The library was changed:", l.Subroutines[0].Instructions)
+		}
+	}
+}
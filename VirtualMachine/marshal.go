@@ -0,0 +1,296 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// Text and JSON representations of instructions, programs and the virtual machine configuration.
+// The JSON field names are the same as the names in the instruction struct, see schema.json.
+// The text format of an instruction is a space separated list of "name=value" for all fields
+// that are not zero, or "noop" if all are zero. A program is one instruction per line.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The largest graycode width, as the serialization uses 16 bits per field
+const MaxWidth = 16
+
+// The settings needed to create an identical VirtualMachine
+type Config struct {
+	Width      uint32 `json:"width"`
+	MemorySize uint32 `json:"memorySize"`
+}
+
+type instructionJSON struct {
+	Clear         int `json:"clear"`
+	AddImmediate  int `json:"addImmediate"`
+	AddIndirect   int `json:"addIndirect"`
+	MultImmediate int `json:"multImmediate"`
+	MultIndirect  int `json:"multIndirect"`
+	StoreAddress  int `json:"storeAddress"`
+	StoreIndirect int `json:"storeIndirect"`
+}
+
+type programJSON struct {
+	Instructions []instruction `json:"instructions"`
+	Penalties    int           `json:"penalties"`
+	Rates        *Rates        `json:"rates,omitempty"`
+}
+
+// Create a virtual machine from a configuration
+func NewFromConfig(c Config) *VirtualMachine {
+	return New(c.Width, c.MemorySize)
+}
+
+func (vm *VirtualMachine) Config() Config {
+	return Config{Width: vm.width, MemorySize: uint32(len(vm.memory))}
+}
+
+func (vm *VirtualMachine) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vm.Config())
+}
+
+// The memory is cleared. The library is not part of the JSON, and is kept.
+func (vm *VirtualMachine) UnmarshalJSON(data []byte) error {
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	library := vm.library
+	*vm = *NewFromConfig(c)
+	vm.library = library
+	return nil
+}
+
+// Needed as Config is also a TextMarshaler, which json would use otherwise
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(plain(c))
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	var ret Config
+	if err := unmarshalStrict(data, (*plain)(&ret)); err != nil {
+		return err
+	}
+	if err := ret.validate(); err != nil {
+		return err
+	}
+	*c = ret
+	return nil
+}
+
+// The same limits as in schema.json
+func (c Config) validate() error {
+	if c.Width < 1 || c.Width > MaxWidth {
+		return fmt.Errorf("width must be between 1 and %d", MaxWidth)
+	}
+	return nil
+}
+
+func (c Config) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("width=%d memorySize=%d", c.Width, c.MemorySize)), nil
+}
+
+func (c *Config) UnmarshalText(text []byte) error {
+	var ret Config
+	err := parsePairs(string(text), func(name string, value int) bool {
+		if value < 0 || uint64(value) > math.MaxUint32 {
+			return false
+		}
+		switch name {
+		case "width":
+			ret.Width = uint32(value)
+		case "memorySize":
+			ret.MemorySize = uint32(value)
+		default:
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if err := ret.validate(); err != nil {
+		return err
+	}
+	*c = ret
+	return nil
+}
+
+func (i instruction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(instructionJSON{
+		Clear:         i.clear,
+		AddImmediate:  i.addImmediate,
+		AddIndirect:   i.addIndirect,
+		MultImmediate: i.multImmediate,
+		MultIndirect:  i.multIndirect,
+		StoreAddress:  i.storeAddress,
+		StoreIndirect: i.storeIndirect,
+	})
+}
+
+func (i *instruction) UnmarshalJSON(data []byte) error {
+	var j instructionJSON
+	if err := unmarshalStrict(data, &j); err != nil {
+		return err
+	}
+	ret := instruction{
+		clear:         j.Clear,
+		addImmediate:  j.AddImmediate,
+		addIndirect:   j.AddIndirect,
+		multImmediate: j.MultImmediate,
+		multIndirect:  j.MultIndirect,
+		storeAddress:  j.StoreAddress,
+		storeIndirect: j.StoreIndirect,
+	}
+	for f := Field(0); f < NumFields; f++ {
+		if v := *ret.field(f); !validField(v) {
+			return fmt.Errorf("vm: %v value %d is outside of [%d, %d]", f, v, minFieldValue, maxFieldValue)
+		}
+	}
+	*i = ret
+	return nil
+}
+
+// Values outside of the range would change when serialized
+func validField(value int) bool {
+	return value >= minFieldValue && value <= maxFieldValue
+}
+
+func (i instruction) MarshalText() ([]byte, error) {
+	var fields []string
+	for f := Field(0); f < NumFields; f++ {
+		if value := *i.field(f); value != 0 {
+			fields = append(fields, fmt.Sprintf("%s=%d", f, value))
+		}
+	}
+	if len(fields) == 0 {
+		return []byte("noop"), nil
+	}
+	return []byte(strings.Join(fields, " ")), nil
+}
+
+func (i *instruction) UnmarshalText(text []byte) error {
+	var ret instruction
+	if strings.TrimSpace(string(text)) != "noop" {
+		err := parsePairs(string(text), func(name string, value int) bool {
+			if !validField(value) {
+				return false
+			}
+			for f := Field(0); f < NumFields; f++ {
+				if fieldNames[f] == name {
+					*ret.field(f) = value
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			return err
+		}
+	}
+	*i = ret
+	return nil
+}
+
+// The virtual machine is not part of the JSON, it has to be set up by NewProgram
+func (p *program) MarshalJSON() ([]byte, error) {
+	instructions := p.instructions
+	if instructions == nil {
+		instructions = []instruction{} // The schema requires an array
+	}
+	return json.Marshal(programJSON{Instructions: instructions, Penalties: p.penalties, Rates: p.rates})
+}
+
+func (p *program) UnmarshalJSON(data []byte) error {
+	var j programJSON
+	if err := unmarshalStrict(data, &j); err != nil {
+		return err
+	}
+	p.instructions = j.Instructions
+	p.penalties = j.Penalties
+	p.rates = j.Rates
+	return nil
+}
+
+// One instruction per line
+func (p *program) MarshalText() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, ins := range p.instructions {
+		text, _ := ins.MarshalText()
+		buf.Write(text)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// Empty lines are ignored. The previous instructions are replaced.
+func (p *program) UnmarshalText(text []byte) error {
+	var instructions []instruction
+	for n, line := range strings.Split(string(text), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var i instruction
+		if err := i.UnmarshalText([]byte(line)); err != nil {
+			return fmt.Errorf("line %d: %v", n+1, err)
+		}
+		instructions = append(instructions, i)
+	}
+	p.instructions = instructions
+	return nil
+}
+
+// Like json.Unmarshal, but unknown fields are errors, as the schema does not allow them
+func unmarshalStrict(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// Parse a space separated list of "name=value". The function set returns false for unknown names
+// or values that are out of range.
+func parsePairs(text string, set func(name string, value int) bool) error {
+	for _, pair := range strings.Fields(text) {
+		eq := strings.IndexByte(pair, '=')
+		if eq < 0 {
+			return fmt.Errorf("expected name=value, got %q", pair)
+		}
+		value, err := strconv.Atoi(pair[eq+1:])
+		if err != nil {
+			return fmt.Errorf("bad value in %q", pair)
+		}
+		if !set(pair[:eq], value) {
+			return fmt.Errorf("unknown name or bad value in %q", pair)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+var marshalTest = []instruction{
+	{clear: 1, addImmediate: 2, addIndirect: 3, multImmediate: 4, multIndirect: 5, storeAddress: 6, storeIndirect: 7},
+	noop,
+	{addImmediate: -5, storeAddress: 2},
+}
+
+func TestInstructionText(t *testing.T) {
+	for _, i := range marshalTest {
+		text, err := i.MarshalText()
+		if err != nil {
+			t.Error("MarshalText returned", err)
+		}
+		var i2 instruction
+		if err := i2.UnmarshalText(text); err != nil {
+			t.Error("UnmarshalText of", string(text), "returned", err)
+		}
+		if i2 != i {
+			t.Error("Failed to convert", i, "through", string(text), "got", i2)
+		}
+	}
+	var i instruction
+	if err := i.UnmarshalText([]byte("addImmediate=1 jump=2")); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+	if err := i.UnmarshalText([]byte("addImmediate")); err == nil {
+		t.Error("Expected error for missing value")
+	}
+}
+
+func TestProgramText(t *testing.T) {
+	p := program{virtualMachine: vmTest, instructions: marshalTest}
+	text, _ := p.MarshalText()
+	p2 := vmTest.NewProgram()
+	if err := p2.UnmarshalText(text); err != nil {
+		t.Fatal("UnmarshalText returned", err)
+	}
+	if len(p2.instructions) != len(marshalTest) {
+		t.Fatal("Expected", len(marshalTest), "instructions, got", p2)
+	}
+	for i := range marshalTest {
+		if p2.instructions[i] != marshalTest[i] {
+			t.Error("Instruction", i, "expected", marshalTest[i], "got", p2.instructions[i])
+		}
+	}
+}
+
+func TestProgramJSON(t *testing.T) {
+	p := program{virtualMachine: vmTest, instructions: marshalTest, penalties: 17}
+	data, err := json.Marshal(&p)
+	if err != nil {
+		t.Fatal("Marshal returned", err)
+	}
+	p2 := vmTest.NewProgram()
+	if err := json.Unmarshal(data, p2); err != nil {
+		t.Fatal("Unmarshal returned", err)
+	}
+	if p2.penalties != p.penalties || len(p2.instructions) != len(p.instructions) {
+		t.Fatal("Failed to convert through", string(data))
+	}
+	for i := range marshalTest {
+		if p2.instructions[i] != marshalTest[i] {
+			t.Error("Instruction", i, "expected", marshalTest[i], "got", p2.instructions[i])
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	vm := New(16, 10)
+	data, err := json.Marshal(vm)
+	if err != nil {
+		t.Fatal("Marshal returned", err)
+	}
+	if string(data) != `{"width":16,"memorySize":10}` {
+		t.Error("Unexpected JSON", string(data))
+	}
+	var vm2 VirtualMachine
+	if err := json.Unmarshal(data, &vm2); err != nil {
+		t.Fatal("Unmarshal returned", err)
+	}
+	if vm2.Config() != vm.Config() || vm2.graycode == nil {
+		t.Error("Expected", vm.Config(), "got", vm2.Config())
+	}
+	l := &Library{}
+	vm2.SetLibrary(l)
+	if err := json.Unmarshal(data, &vm2); err != nil || vm2.Library() != l {
+		t.Error("Expected the library to be kept, got", vm2.Library(), err)
+	}
+	text, _ := vm.Config().MarshalText()
+	var c Config
+	if err := c.UnmarshalText(text); err != nil || c != vm.Config() {
+		t.Error("Failed to convert through", string(text), err)
+	}
+}
+
+// Data that the schema rejects shall also be rejected when decoded
+func TestStrictJSON(t *testing.T) {
+	var i instruction
+	if err := json.Unmarshal([]byte(`{"addImmediate":1,"add":2}`), &i); err == nil {
+		t.Error("Expected an error for an unknown instruction field")
+	}
+	for _, data := range []string{`{"addImmediate":100000}`, `{"storeAddress":-50000}`} {
+		if err := json.Unmarshal([]byte(data), &i); err == nil {
+			t.Error("Expected an error for", data)
+		}
+	}
+	for _, text := range []string{"addImmediate=100000", "storeAddress=-50000"} {
+		if err := i.UnmarshalText([]byte(text)); err == nil {
+			t.Error("Expected an error for", text)
+		}
+	}
+	for _, text := range []string{"addImmediate=16383", "addImmediate=-49152"} {
+		if err := i.UnmarshalText([]byte(text)); err != nil {
+			t.Error("Unexpected error for", text, err)
+		}
+	}
+	p := vmTest.NewProgram()
+	if err := json.Unmarshal([]byte(`{"instructions":[],"cost":1}`), p); err == nil {
+		t.Error("Expected an error for an unknown program field")
+	}
+	var vm VirtualMachine
+	for _, data := range []string{`{"width":0,"memorySize":10}`, `{"memorySize":10}`, `{"width":16,"size":10}`} {
+		if err := json.Unmarshal([]byte(data), &vm); err == nil {
+			t.Error("Expected an error for", data)
+		}
+	}
+	for _, data := range []string{`{"width":17,"memorySize":10}`, `{"width":16,"memorySize":-1}`} {
+		if err := json.Unmarshal([]byte(data), &vm); err == nil {
+			t.Error("Expected an error for", data)
+		}
+	}
+	var c Config
+	for _, text := range []string{"width=0 memorySize=4", "width=17 memorySize=4", "width=16 memorySize=-1", "width=-1 memorySize=4", "width=4294967297 memorySize=4"} {
+		if err := c.UnmarshalText([]byte(text)); err == nil {
+			t.Error("Expected an error for", text)
+		}
+	}
+	data, _ := json.Marshal(vmTest.NewProgram())
+	if !strings.Contains(string(data), `"instructions":[]`) {
+		t.Error("Expected an empty array for an empty program, got", string(data))
+	}
+}
+
+// The schema shall use the same field names as the JSON encoding
+func TestSchema(t *testing.T) {
+	data, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Definitions map[string]struct {
+			Properties map[string]interface{}
+		}
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal("Failed to parse schema:", err)
+	}
+	check := func(name string, v interface{}) {
+		data, _ := json.Marshal(v)
+		var m map[string]interface{}
+		json.Unmarshal(data, &m)
+		props := schema.Definitions[name].Properties
+		if len(props) != len(m) {
+			t.Error("Schema for", name, "has", len(props), "properties, but JSON has", len(m))
+		}
+		for key := range m {
+			if _, ok := props[key]; !ok {
+				t.Error("Schema for", name, "is missing", key)
+			}
+		}
+	}
+	check("instruction", marshalTest[0])
+	check("program", &program{rates: &Rates{}})
+	check("rates", Rates{})
+	check("config", Config{})
+	check("subroutine", Subroutine{})
+	check("library", &Library{})
+	for f := Field(0); f < NumFields; f++ {
+		if _, ok := schema.Definitions["instruction"].Properties[f.String()]; !ok {
+			t.Error("Schema is missing field", f)
+		}
+	}
+}
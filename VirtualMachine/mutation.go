@@ -21,12 +21,119 @@ import (
 	"math/rand"
 )
 
+// A mutation operator. Apply returns true if the program was changed.
+type Mutator interface {
+	Apply(p *program, r *rand.Rand) bool
+}
+
+// A list of mutation operators, applied in order
+type Pipeline []Mutator
+
+// Bit mutation of the serialized program, see mutate
+type BitMutation struct {
+	Prob float32
+}
+
 // Given a serialized program, mutate random bits depending on prability
 func mutate(code []byte, prob float32) {
+	mutateBits(code, prob, rand.Float32)
+}
+
+func mutateBits(code []byte, prob float32, random func() float32) (changed bool) {
 	for i := range code {
-		if rand.Float32() <= prob {
-			bit := uint(rand.Float32() * 8)
+		if random() <= prob {
+			bit := uint(random() * 8)
 			code[i] ^= 1 << bit
+			changed = true
+		}
+	}
+	return
+}
+
+func (pl Pipeline) Apply(p *program, r *rand.Rand) (changed bool) {
+	for _, m := range pl {
+		if m.Apply(p, r) {
+			changed = true
+		}
+	}
+	return
+}
+
+func (m BitMutation) Apply(p *program, r *rand.Rand) bool {
+	code, _ := p.MarshalBinary()
+	if !mutateBits(code, m.Prob, r.Float32) {
+		return false
+	}
+	p.instructions = nil
+	p.UnmarshalBinary(code)
+	return true
+}
+
+// Number of bits in a serialized field
+const fieldBits = 16
+
+// Mutation of decoded instructions, where every field has its own mutation rate.
+// A mutation flips one bit in the graycoded value of the field. The bit is chosen
+// using BitWeights, where index 0 is the least significant bit. If BitWeights is
+// empty, all bits have the same weight. Missing weights are 0.
+type FieldMutation struct {
+	Rates      [NumFields]float32 // Probability per instruction that a field is mutated
+	BitWeights []float32
+}
+
+// Description of a mutated field
+type FieldChange struct {
+	Instruction int // Index in the program
+	Field       Field
+	Bit         uint // The bit in the graycoded value that was flipped
+	Old, New    int
+}
+
+// Mutate the instructions of a program, and report the fields that were changed
+func (m *FieldMutation) Mutate(p *program, r *rand.Rand) (changes []FieldChange) {
+	gc := p.virtualMachine.graycode
+	for n := range p.instructions {
+		for f := Field(0); f < NumFields; f++ {
+			if r.Float32() >= m.Rates[f] {
+				continue
+			}
+			value := p.instructions[n].field(f)
+			bit := m.chooseBit(r)
+			old := *value
+			*value = fromMgc(toMgc(old, gc)^(1<<bit), gc)
+			changes = append(changes, FieldChange{Instruction: n, Field: f, Bit: bit, Old: old, New: *value})
 		}
 	}
+	return
+}
+
+func (m *FieldMutation) chooseBit(r *rand.Rand) uint {
+	if len(m.BitWeights) == 0 {
+		return uint(r.Intn(fieldBits))
+	}
+	var sum float32
+	for bit := 0; bit < fieldBits && bit < len(m.BitWeights); bit++ {
+		sum += m.BitWeights[bit]
+	}
+	choice := r.Float32() * sum
+	for bit := 0; bit < fieldBits && bit < len(m.BitWeights); bit++ {
+		choice -= m.BitWeights[bit]
+		if choice < 0 {
+			return uint(bit)
+		}
+	}
+	// Only possible from rounding errors, or if all weights are 0
+	return 0
+}
+
+func (m *FieldMutation) Apply(p *program, r *rand.Rand) bool {
+	return len(m.Mutate(p, r)) > 0
+}
+
+// Count the number of changes for each field
+func CountFields(changes []FieldChange) (count [NumFields]int) {
+	for _, c := range changes {
+		count[c.Field]++
+	}
+	return
 }
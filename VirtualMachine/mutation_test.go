@@ -19,6 +19,7 @@ package vm
 
 import (
 	"log"
+	"math/rand"
 	"testing"
 )
 
@@ -36,3 +37,37 @@ func TestMutation(t *testing.T) {
 	p2.UnmarshalBinary(bin)
 	log.Print(p2.String())
 }
+
+func TestFieldMutation(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	p := program{virtualMachine: vmTest}
+	for i := 0; i < 1000; i++ {
+		p.instructions = append(p.instructions, noop)
+	}
+	var m FieldMutation
+	m.Rates[FieldAddImmediate] = 0.5
+	m.Rates[FieldStoreAddress] = 0.1
+	m.BitWeights = []float32{1, 1, 1, 1} // Only the least significant bits
+	changes := m.Mutate(&p, r)
+	count := CountFields(changes)
+	if count[FieldClear] != 0 || count[FieldAddIndirect] != 0 {
+		t.Error("Fields with rate 0 were mutated:", count)
+	}
+	if count[FieldAddImmediate] < 400 || count[FieldAddImmediate] > 600 {
+		t.Error("Expected about 500 mutations of addImmediate, got", count[FieldAddImmediate])
+	}
+	if count[FieldStoreAddress] < 50 || count[FieldStoreAddress] > 150 {
+		t.Error("Expected about 100 mutations of storeAddress, got", count[FieldStoreAddress])
+	}
+	for _, c := range changes {
+		if c.Bit >= 4 {
+			t.Error("Bit", c.Bit, "has weight 0")
+		}
+		if got := *p.instructions[c.Instruction].field(c.Field); got != c.New || c.Old != 0 {
+			t.Error("Change", c, "does not match instruction", p.instructions[c.Instruction])
+		}
+		if c.New == c.Old {
+			t.Error("Change", c, "did not change the value")
+		}
+	}
+}
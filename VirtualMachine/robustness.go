@@ -0,0 +1,217 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// Measure how resilient a program is to bit mutations. Every bit in the serialized program
+// is flipped, one at a time, and the changed program is compared to the original on a set
+// of inputs.
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+type Robustness struct {
+	Layout Layout
+	Inputs [][]int // One input per test case
+	Sample int     // Number of random bit flips to test. 0 means all bits.
+}
+
+// The result of one bit flip
+type Flip struct {
+	Instruction   int
+	Field         Field
+	Bit           uint    // Bit in the serialized field value, 0 is the least significant
+	OutputChange  float64 // Sum of the absolute output differences, mean over the test cases
+	PenaltyChange int     // Sum over all test cases
+}
+
+type RobustnessReport struct {
+	Flips []Flip
+}
+
+// Statistics for a group of flips
+type FlipStats struct {
+	Count            int
+	Neutral          float64 // Fraction of flips that changed neither output nor penalties
+	MeanOutputChange float64
+	MedianOutput     float64
+	MaxOutputChange  float64
+	MeanPenalty      float64
+}
+
+func (f *Flip) Neutral() bool {
+	return f.OutputChange == 0 && f.PenaltyChange == 0
+}
+
+// Flip bits of the serialized program one at a time, and measure the change of the
+// outputs and penalties. The random source chooses the bits if Sample is used, and is
+// required then. It may be nil if Sample is 0.
+func (a *Robustness) Analyze(p *program, r *rand.Rand) *RobustnessReport {
+	code, _ := p.MarshalBinary()
+	outputs, penalties := a.evaluate(p)
+	bits := len(code) * 8
+	var positions []int
+	if a.Sample > 0 && a.Sample < bits {
+		positions = r.Perm(bits)[:a.Sample]
+		sort.Ints(positions)
+	} else {
+		for i := 0; i < bits; i++ {
+			positions = append(positions, i)
+		}
+	}
+	report := &RobustnessReport{}
+	mutated := make([]byte, len(code))
+	for _, pos := range positions {
+		copy(mutated, code)
+		mutated[pos/8] ^= 1 << uint(pos%8)
+		p2 := p.virtualMachine.NewProgram()
+		p2.UnmarshalBinary(mutated)
+		outputs2, penalties2 := a.evaluate(p2)
+		offset := pos / 8 % InstructionSize
+		flip := Flip{
+			Instruction:   pos / 8 / InstructionSize,
+			Field:         Field(offset / 2),
+			Bit:           uint(offset%2*8 + pos%8), // Little endian
+			PenaltyChange: penalties2 - penalties,
+		}
+		for c := range outputs {
+			for o := range outputs[c] {
+				flip.OutputChange += math.Abs(float64(outputs2[c][o] - outputs[c][o]))
+			}
+		}
+		if len(outputs) > 0 {
+			flip.OutputChange /= float64(len(outputs))
+		}
+		report.Flips = append(report.Flips, flip)
+	}
+	return report
+}
+
+// Run all test cases, each from cleared memory
+func (a *Robustness) evaluate(p *program) (outputs [][]int, penalties int) {
+	for _, input := range a.Inputs {
+		p.virtualMachine.Reset()
+		output, pen, _ := p.Call(a.Layout, input)
+		outputs = append(outputs, output)
+		penalties += pen
+	}
+	return
+}
+
+func stats(flips []Flip) (s FlipStats) {
+	s.Count = len(flips)
+	if s.Count == 0 {
+		return
+	}
+	changes := make([]float64, 0, len(flips))
+	for i := range flips {
+		f := &flips[i]
+		if f.Neutral() {
+			s.Neutral++
+		}
+		s.MeanOutputChange += f.OutputChange
+		s.MeanPenalty += float64(f.PenaltyChange)
+		s.MaxOutputChange = math.Max(s.MaxOutputChange, f.OutputChange)
+		changes = append(changes, f.OutputChange)
+	}
+	sort.Float64s(changes)
+	s.MedianOutput = changes[len(changes)/2]
+	n := float64(s.Count)
+	s.Neutral /= n
+	s.MeanOutputChange /= n
+	s.MeanPenalty /= n
+	return
+}
+
+// Statistics for every bit position of a field
+func (rep *RobustnessReport) ByBit(f Field) (ret [fieldBits]FlipStats) {
+	var groups [fieldBits][]Flip
+	for _, flip := range rep.Flips {
+		if flip.Field == f {
+			groups[flip.Bit] = append(groups[flip.Bit], flip)
+		}
+	}
+	for bit := range groups {
+		ret[bit] = stats(groups[bit])
+	}
+	return
+}
+
+// Statistics for every field, all bits combined
+func (rep *RobustnessReport) ByField() (ret [NumFields]FlipStats) {
+	var groups [NumFields][]Flip
+	for _, flip := range rep.Flips {
+		groups[flip.Field] = append(groups[flip.Field], flip)
+	}
+	for f := range groups {
+		ret[f] = stats(groups[f])
+	}
+	return
+}
+
+// One row per field and bit position, followed by one row per field where bit is "all"
+func (rep *RobustnessReport) rows() (rows [][]string) {
+	format := func(f Field, bit string, s FlipStats) []string {
+		return []string{f.String(), bit, strconv.Itoa(s.Count),
+			strconv.FormatFloat(s.Neutral, 'f', 3, 64),
+			strconv.FormatFloat(s.MeanOutputChange, 'g', 4, 64),
+			strconv.FormatFloat(s.MedianOutput, 'g', 4, 64),
+			strconv.FormatFloat(s.MaxOutputChange, 'g', 4, 64),
+			strconv.FormatFloat(s.MeanPenalty, 'g', 4, 64)}
+	}
+	for f := Field(0); f < NumFields; f++ {
+		for bit, s := range rep.ByBit(f) {
+			if s.Count > 0 {
+				rows = append(rows, format(f, strconv.Itoa(bit), s))
+			}
+		}
+	}
+	for f, s := range rep.ByField() {
+		if s.Count > 0 {
+			rows = append(rows, format(Field(f), "all", s))
+		}
+	}
+	return
+}
+
+var reportHeader = []string{"field", "bit", "flips", "neutral", "mean output", "median output", "max output", "mean penalty"}
+
+func (rep *RobustnessReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(reportHeader)
+	cw.WriteAll(rep.rows())
+	return cw.Error()
+}
+
+func (rep *RobustnessReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, row := range append([][]string{reportHeader}, rep.rows()...) {
+		for _, col := range row {
+			fmt.Fprint(tw, col, "\t")
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
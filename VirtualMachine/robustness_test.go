@@ -0,0 +1,80 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRobustness(t *testing.T) {
+	vm := New(16, 10)
+	p := vm.NewProgram()
+	p.instructions = []instruction{{addImmediate: 5, addIndirect: 1, storeAddress: 2}}
+	a := Robustness{Layout: Layout{Input: []int{1}, Output: []int{2}}, Inputs: [][]int{{1}, {2}, {3}}}
+	report := a.Analyze(p, rand.New(rand.NewSource(1)))
+	if len(report.Flips) != InstructionSize*8 {
+		t.Fatal("Expected", InstructionSize*8, "flips, got", len(report.Flips))
+	}
+	byField := report.ByField()
+	// The clear field has no effect when the result is always stored
+	if s := byField[FieldClear]; s.Count != fieldBits || s.Neutral != 1 {
+		t.Error("Expected all flips in clear to be neutral, got", s)
+	}
+	if s := byField[FieldAddImmediate]; s.Neutral != 0 || s.MeanOutputChange == 0 {
+		t.Error("Expected all flips in addImmediate to change the output, got", s)
+	}
+	if s := byField[FieldStoreAddress]; s.MeanPenalty <= 0 && s.MeanOutputChange == 0 {
+		t.Error("Expected flips in storeAddress to change output or penalties, got", s)
+	}
+	// The lowest bit of the immediate value should change the output by exactly 1
+	if s := report.ByBit(FieldAddImmediate)[0]; s.Count != 1 || s.MaxOutputChange != 1 {
+		t.Error("Expected a flip of bit 0 to change the output by 1, got", s)
+	}
+
+	a.Sample = 10
+	if report := a.Analyze(p, rand.New(rand.NewSource(1))); len(report.Flips) != 10 {
+		t.Error("Expected 10 flips, got", len(report.Flips))
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Error("WriteCSV returned", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1+countBitRows(report)+int(NumFields) {
+		t.Error("Unexpected number of lines in CSV:", len(lines))
+	}
+	buf.Reset()
+	report.WriteTable(&buf)
+	t.Log("\n", buf.String())
+}
+
+// Number of field and bit combinations in the report
+func countBitRows(rep *RobustnessReport) (n int) {
+	for f := Field(0); f < NumFields; f++ {
+		for _, s := range rep.ByBit(f) {
+			if s.Count > 0 {
+				n++
+			}
+		}
+	}
+	return
+}
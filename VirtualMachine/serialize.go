@@ -20,10 +20,15 @@ package vm
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"github.com/larspensjo/go-monotonic-graycode"
 	"log"
 )
 
+// Number of bytes used by a serialized instruction
+const InstructionSize = int(NumFields) * 2
+
+// Only the instructions. The mutation rates are stored next to the genome, see Rates.MarshalBinary.
 func (p *program) MarshalBinary() (data []byte, err error) {
 	buf := new(bytes.Buffer)
 	for _, ins := range p.instructions {
@@ -32,24 +37,49 @@ func (p *program) MarshalBinary() (data []byte, err error) {
 	return buf.Bytes(), nil
 }
 
-func (p *program) UnmarshalBinary(data []byte) {
+func (p *program) UnmarshalBinary(data []byte) error {
+	if len(data)%InstructionSize != 0 {
+		return fmt.Errorf("vm: program length %d is not a multiple of %d", len(data), InstructionSize)
+	}
 	b := bytes.NewBuffer(data)
 	for b.Len() > 0 {
 		var i instruction
 		i.decode(b, p.virtualMachine.graycode)
 		p.instructions = append(p.instructions, i)
 	}
+	return nil
 }
 
-// Take a binary number, convert it to mgc, and encode it into a 4-byte array
-func encodeMgc(number int, b *bytes.Buffer, m *mgc.Mgc) {
+// Convert a signed number to the mgc value used in the serialization
+func toMgc(number int, m *mgc.Mgc) uint16 {
 	// Convert the signed number to an unsigned that can be used for MGC.
 	var unsigned uint32 = uint32(number)
 	if number < 0 {
-		unsigned = uint32(0x10000 - number)
+		unsigned = uint32(0x10000 + number)
+	}
+	return uint16(m.GetMgc(unsigned))
+}
+
+// The range of field values that are preserved by the serialization, see fromMgc
+const (
+	minFieldValue = 0x3FFF - 0xFFFF
+	maxFieldValue = 0x3FFF
+)
+
+// Convert a serialized mgc value back to a signed number
+func fromMgc(code uint16, m *mgc.Mgc) int {
+	var tmp uint32 = m.GetInt(mgc.MgcNumber(code))
+	// MGC only handles unsigned, convert to signed int
+	ret := int(tmp)
+	if tmp > 0x3FFF {
+		ret = int(tmp) - 0x10000
 	}
-	converted := uint16(m.GetMgc(unsigned))
-	err := binary.Write(b, binary.LittleEndian, converted)
+	return ret
+}
+
+// Take a binary number, convert it to mgc, and encode it into a 4-byte array
+func encodeMgc(number int, b *bytes.Buffer, m *mgc.Mgc) {
+	err := binary.Write(b, binary.LittleEndian, toMgc(number, m))
 	if err != nil {
 		log.Fatalln("encodeMgc failed", err)
 	}
@@ -62,13 +92,7 @@ func decodeMgc(b *bytes.Buffer, m *mgc.Mgc) int {
 	if err != nil {
 		log.Fatal("failed to read number from stream")
 	}
-	var tmp uint32 = m.GetInt(mgc.MgcNumber(number))
-	// MGC only handles unsigned, convert to signed int
-	ret := int(tmp)
-	if tmp > 0x3FFF {
-		ret = int(tmp - 0x10000)
-	}
-	return ret
+	return fromMgc(number, m)
 }
 
 func (i *instruction) encode(b *bytes.Buffer, m *mgc.Mgc) {
@@ -38,3 +38,11 @@ func TestSerialization(t *testing.T) {
 		t.Error("Failed to serialize/deserialize:", i, p2.instructions[0])
 	}
 }
+
+func TestSerializeNegative(t *testing.T) {
+	for _, n := range []int{-1, -100, -0x3FFF, 0x3FFF} {
+		if got := fromMgc(toMgc(n, vmTest.graycode), vmTest.graycode); got != n {
+			t.Error("Expected", n, "got", got)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// Static simplification of programs. A liveness analysis finds the memory cells that
+// can affect the output, and everything that does not contribute is removed.
+//
+// As the value of an instruction always starts from 0, the clear and multiplication
+// fields never change it. Fields that can give a penalty are kept, so that the
+// simplified program gets the same penalties.
+
+// Return a simplified copy of the program. Only the output cells of the layout are
+// considered to be used after the program. If the memory is kept between calls, cells
+// with state have to be included in the output.
+func (p *program) Simplify(l Layout) *program {
+	memory := len(p.virtualMachine.memory)
+	live := make([]bool, memory)
+	for _, addr := range l.Output {
+		if addr >= 0 && addr < memory {
+			live[addr] = true
+		}
+	}
+	address := func(addr int) bool { // 0 means that the field is not used
+		return addr > 0 && addr < memory
+	}
+	simplified := make([]instruction, len(p.instructions))
+	keep := 0
+	for pc := len(p.instructions) - 1; pc >= 0; pc-- {
+		ins := p.instructions[pc]
+		ins.clear = 0
+		ins.multImmediate = 0
+		if address(ins.multIndirect) {
+			ins.multIndirect = 0
+		}
+		// The store through storeIndirect is done last, and can write to any cell. It
+		// depends on the memory at run time, so it is always kept.
+		needValue := false
+		if address(ins.storeIndirect) {
+			live[ins.storeIndirect] = true
+			needValue = true
+		}
+		if address(ins.storeAddress) {
+			if live[ins.storeAddress] {
+				live[ins.storeAddress] = false
+				needValue = true
+			} else {
+				ins.storeAddress = 0 // Dead store
+			}
+		}
+		if needValue {
+			if address(ins.addIndirect) {
+				live[ins.addIndirect] = true
+			}
+		} else {
+			ins.addImmediate = 0
+			if address(ins.addIndirect) {
+				ins.addIndirect = 0
+			}
+		}
+		if ins != noop {
+			keep++
+			simplified[len(simplified)-keep] = ins
+		}
+	}
+	ret := p.virtualMachine.NewProgram()
+	ret.instructions = simplified[len(simplified)-keep:]
+	return ret
+}
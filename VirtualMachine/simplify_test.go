@@ -0,0 +1,88 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	m := New(16, 10)
+	p := m.NewProgram()
+	p.instructions = []instruction{
+		{clear: 150, addImmediate: 3, storeAddress: 5},                       // Dead, overwritten below
+		{addImmediate: 1, addIndirect: 1, multImmediate: 7, storeAddress: 5}, // Used
+		{addImmediate: 9, storeAddress: 6},                                   // Never used
+		{addIndirect: 5, multIndirect: 3, storeAddress: 2},                   // Output
+		{addImmediate: 4, addIndirect: 20, storeAddress: 7},                  // Dead, but gives a penalty
+		noop,
+	}
+	s := p.Simplify(Layout{Input: []int{1}, Output: []int{2}})
+	expected := []instruction{
+		{addImmediate: 1, addIndirect: 1, storeAddress: 5},
+		{addIndirect: 5, storeAddress: 2},
+		{addIndirect: 20},
+	}
+	if len(s.instructions) != len(expected) {
+		t.Fatal("Expected", expected, "got", s.instructions)
+	}
+	for i := range expected {
+		if s.instructions[i] != expected[i] {
+			t.Error("Instruction", i, "expected", expected[i], "got", s.instructions[i])
+		}
+	}
+	if len(p.instructions) != 6 {
+		t.Error("The original program shall not change")
+	}
+}
+
+// Simplified programs shall give the same output and penalties as the originals
+func TestSimplifyDifferential(t *testing.T) {
+	const memory = 8
+	m := New(16, memory)
+	r := rand.New(rand.NewSource(1))
+	l := Layout{Input: []int{1, 2}, Output: []int{3, 4}}
+	var before, after int
+	for n := 0; n < 500; n++ {
+		p := m.RandomProgram(r.Intn(20), r)
+		for i := range p.instructions {
+			// Some fields outside of the memory, to get penalties
+			if f := Field(r.Intn(int(NumFields))); f != FieldClear && r.Intn(4) == 0 {
+				*p.instructions[i].field(f) = r.Intn(memory+6) - 3
+			}
+		}
+		s := p.Simplify(l)
+		before += len(p.instructions)
+		after += len(s.instructions)
+		for k := 0; k < 5; k++ {
+			input := []int{r.Intn(memory+4) - 2, r.Intn(memory+4) - 2}
+			m.Reset()
+			out1, pen1, _ := p.Call(l, input)
+			m.Reset()
+			out2, pen2, _ := s.Call(l, input)
+			if out1[0] != out2[0] || out1[1] != out2[1] || pen1 != pen2 {
+				t.Fatal("Program", p, "simplified to", s, "gave", out2, pen2, "instead of", out1, pen1, "for input", input)
+			}
+		}
+	}
+	if after >= before {
+		t.Error("Expected fewer instructions, got", after, "from", before)
+	}
+	t.Log("Simplified", before, "instructions to", after)
+}
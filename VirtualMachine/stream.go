@@ -0,0 +1,156 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+// Streaming of many programs. Every program is written as a frame, which is the
+// length of the MarshalBinary encoding as a uvarint, a frame type byte, and the
+// MarshalBinary encoding. Frames of type frameRates are followed by the Rates encoding.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Protect against allocating huge buffers from corrupt streams
+const maxFrameSize = 1 << 24
+
+// Frame types
+const (
+	frameGenome = iota // Only the genome
+	frameRates         // The genome followed by the mutation rates
+)
+
+type Encoder struct {
+	w io.Writer
+}
+
+type Decoder struct {
+	r  *bufio.Reader
+	vm *VirtualMachine
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Decoded programs will use the virtual machine vm
+func NewDecoder(r io.Reader, vm *VirtualMachine) *Decoder {
+	return &Decoder{r: bufio.NewReader(r), vm: vm}
+}
+
+func (e *Encoder) Encode(p *program) error {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return e.EncodeGenomeRates(data, p.rates)
+}
+
+// Write a program that is already serialized
+func (e *Encoder) EncodeGenome(genome []byte) error {
+	return e.EncodeGenomeRates(genome, nil)
+}
+
+// Write a serialized program and its mutation rates, which may be nil
+func (e *Encoder) EncodeGenomeRates(genome []byte, rates *Rates) error {
+	if len(genome)%InstructionSize != 0 || len(genome) > maxFrameSize {
+		return fmt.Errorf("vm: invalid genome length %d", len(genome))
+	}
+	header := make([]byte, binary.MaxVarintLen64+1)
+	n := binary.PutUvarint(header, uint64(len(genome)))
+	header[n] = frameGenome
+	var trailer []byte
+	if rates != nil {
+		header[n] = frameRates
+		trailer, _ = rates.MarshalBinary()
+	}
+	frame := append(append(header[:n+1], genome...), trailer...)
+	_, err := e.w.Write(frame)
+	return err
+}
+
+// Read the next program. Returns io.EOF when there are no more programs.
+func (d *Decoder) Decode() (*program, error) {
+	genome, rates, err := d.DecodeGenomeRates()
+	if err != nil {
+		return nil, err
+	}
+	p := d.vm.NewProgram()
+	if err := p.UnmarshalBinary(genome); err != nil {
+		return nil, err
+	}
+	p.rates = rates
+	return p, nil
+}
+
+// Read the next program without deserializing it, and without the mutation rates.
+// Returns io.EOF when there are no more programs.
+func (d *Decoder) DecodeGenome() ([]byte, error) {
+	genome, _, err := d.DecodeGenomeRates()
+	return genome, err
+}
+
+// Read the next program without deserializing it. The rates are nil if the program
+// has none. Returns io.EOF when there are no more programs.
+func (d *Decoder) DecodeGenomeRates() ([]byte, *Rates, error) {
+	length, err := binary.ReadUvarint(d.r)
+	if err == io.EOF {
+		return nil, nil, io.EOF
+	}
+	if err != nil {
+		return nil, nil, unexpected(err)
+	}
+	if length > maxFrameSize || length%uint64(InstructionSize) != 0 {
+		return nil, nil, fmt.Errorf("vm: invalid frame length %d", length)
+	}
+	kind, err := d.r.ReadByte()
+	if err != nil {
+		return nil, nil, unexpected(err)
+	}
+	size := length
+	switch kind {
+	case frameGenome:
+	case frameRates:
+		size += RatesSize
+	default:
+		return nil, nil, fmt.Errorf("vm: invalid frame type %d", kind)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(d.r, frame); err != nil {
+		return nil, nil, unexpected(err)
+	}
+	if kind == frameGenome {
+		return frame, nil, nil
+	}
+	rates := new(Rates)
+	if err := rates.UnmarshalBinary(frame[length:]); err != nil {
+		return nil, nil, err
+	}
+	return frame[:length], rates, nil
+}
+
+// A stream that ends inside a frame is corrupt
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	var programs []*program
+	for n := 0; n < 10; n++ {
+		p := vmTest.NewProgram()
+		for i := 0; i < n; i++ {
+			p.instructions = append(p.instructions, instruction{addImmediate: i, storeAddress: n})
+		}
+		programs = append(programs, p)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := NewEncoder(zw)
+	for _, p := range programs {
+		if err := enc.Encode(p); err != nil {
+			t.Fatal("Encode returned", err)
+		}
+	}
+	zw.Close()
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := NewDecoder(zr, vmTest)
+	for n, p := range programs {
+		p2, err := dec.Decode()
+		if err != nil {
+			t.Fatal("Decode of program", n, "returned", err)
+		}
+		if len(p2.instructions) != len(p.instructions) {
+			t.Fatal("Program", n, "expected", p, "got", p2)
+		}
+		for i := range p.instructions {
+			if p.instructions[i] != p2.instructions[i] {
+				t.Error("Program", n, "instruction", i, "expected", p.instructions[i], "got", p2.instructions[i])
+			}
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Error("Expected io.EOF at end of stream, got", err)
+	}
+}
+
+func TestStreamCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	p := program{virtualMachine: vmTest, instructions: []instruction{noop, noop}}
+	NewEncoder(&buf).Encode(&p)
+	data := buf.Bytes()
+
+	if _, err := NewDecoder(bytes.NewReader(data[:len(data)-1]), vmTest).Decode(); err != io.ErrUnexpectedEOF {
+		t.Error("Expected io.ErrUnexpectedEOF from truncated stream, got", err)
+	}
+	data[1] = 2 // Unknown frame type
+	if _, err := NewDecoder(bytes.NewReader(data), vmTest).Decode(); err == nil {
+		t.Error("Expected error from invalid frame type")
+	}
+	data[1] = frameGenome
+	data[0]-- // Length is no longer a multiple of the instruction size
+	if _, err := NewDecoder(bytes.NewReader(data), vmTest).Decode(); err == nil {
+		t.Error("Expected error from invalid length")
+	}
+	if err := NewEncoder(&buf).EncodeGenome(make([]byte, InstructionSize+RatesSize)); err == nil {
+		t.Error("Expected error from encoding an invalid genome")
+	}
+}
+
+func TestStreamRates(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	with := program{virtualMachine: vmTest, instructions: []instruction{noop}, rates: &Rates{Bit: 0.02, Structural: 3}}
+	without := program{virtualMachine: vmTest, instructions: []instruction{noop, noop}}
+	enc.Encode(&with)
+	enc.Encode(&without)
+	dec := NewDecoder(&buf, vmTest)
+	p, err := dec.Decode()
+	if err != nil || len(p.instructions) != 1 || p.rates == nil || *p.rates != *with.rates {
+		t.Error("Expected the rates", *with.rates, "got", p, err)
+	}
+	p, err = dec.Decode()
+	if err != nil || len(p.instructions) != 2 || p.rates != nil {
+		t.Error("Expected two instructions without rates, got", p, err)
+	}
+}
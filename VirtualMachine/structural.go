@@ -0,0 +1,118 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"math/rand"
+)
+
+// Mutations that change the length or order of a program. Every operator is applied
+// at most once per call, with its own probability.
+type StructuralMutation struct {
+	Insert     float32 // Insert a random instruction
+	InsertNoop float32 // Insert a noop
+	Delete     float32 // Delete an instruction
+	Duplicate  float32 // Insert a copy of a block of instructions
+	Swap       float32 // Swap two instructions
+	Move       float32 // Move a block of instructions to another position
+	MaxLength  int     // Programs will not grow beyond this length. 0 means no limit.
+	MaxBlock   int     // Maximum number of instructions in a duplicated or moved block. Default is 1.
+}
+
+func (m *StructuralMutation) Apply(p *program, r *rand.Rand) (changed bool) {
+	if r.Float32() < m.Delete && len(p.instructions) > 0 {
+		pos := r.Intn(len(p.instructions))
+		p.instructions = append(p.instructions[:pos], p.instructions[pos+1:]...)
+		changed = true
+	}
+	if r.Float32() < m.Insert && m.room(p, 1) {
+		p.insert(r.Intn(len(p.instructions)+1), randomInstruction(r, len(p.virtualMachine.memory)))
+		changed = true
+	}
+	if r.Float32() < m.InsertNoop && m.room(p, 1) {
+		p.insert(r.Intn(len(p.instructions)+1), noop)
+		changed = true
+	}
+	if r.Float32() < m.Duplicate && len(p.instructions) > 0 {
+		start, end := m.block(p, r)
+		if m.room(p, end-start) {
+			block := append([]instruction(nil), p.instructions[start:end]...)
+			p.insert(r.Intn(len(p.instructions)+1), block...)
+			changed = true
+		}
+	}
+	if r.Float32() < m.Swap && len(p.instructions) > 1 {
+		a, b := r.Intn(len(p.instructions)), r.Intn(len(p.instructions))
+		p.instructions[a], p.instructions[b] = p.instructions[b], p.instructions[a]
+		changed = true
+	}
+	if r.Float32() < m.Move && len(p.instructions) > 1 {
+		start, end := m.block(p, r)
+		block := append([]instruction(nil), p.instructions[start:end]...)
+		p.instructions = append(p.instructions[:start], p.instructions[end:]...)
+		p.insert(r.Intn(len(p.instructions)+1), block...)
+		changed = true
+	}
+	return
+}
+
+// Check if there is room for more instructions
+func (m *StructuralMutation) room(p *program, n int) bool {
+	return m.MaxLength == 0 || len(p.instructions)+n <= m.MaxLength
+}
+
+// Choose a random block of instructions
+func (m *StructuralMutation) block(p *program, r *rand.Rand) (start, end int) {
+	size := 1
+	if m.MaxBlock > 1 {
+		size = 1 + r.Intn(m.MaxBlock)
+	}
+	if size > len(p.instructions) {
+		size = len(p.instructions)
+	}
+	start = r.Intn(len(p.instructions) - size + 1)
+	return start, start + size
+}
+
+// Insert instructions at position pos
+func (p *program) insert(pos int, ins ...instruction) {
+	// A new slice, as appending to ins could write into memory owned by the caller
+	list := make([]instruction, 0, len(p.instructions)+len(ins))
+	list = append(list, p.instructions[:pos]...)
+	list = append(list, ins...)
+	p.instructions = append(list, p.instructions[pos:]...)
+}
+
+// Create an instruction where addresses are within the memory
+func randomInstruction(r *rand.Rand, memorySize int) instruction {
+	address := func() int {
+		if memorySize == 0 {
+			return 0
+		}
+		return r.Intn(memorySize)
+	}
+	return instruction{
+		clear:         r.Intn(2 * parClearThreshold),
+		addImmediate:  r.Intn(2*parMultScaling+1) - parMultScaling,
+		addIndirect:   address(),
+		multImmediate: r.Intn(2*parMultScaling+1) - parMultScaling,
+		multIndirect:  address(),
+		storeAddress:  address(),
+		storeIndirect: address(),
+	}
+}
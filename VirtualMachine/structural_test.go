@@ -0,0 +1,94 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package vm
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Make a program where all instructions are different
+func numberedProgram(n int) *program {
+	p := vmTest.NewProgram()
+	for i := 0; i < n; i++ {
+		p.instructions = append(p.instructions, instruction{addImmediate: i + 1})
+	}
+	return p
+}
+
+func TestStructuralLength(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	m := StructuralMutation{Insert: 0.5, InsertNoop: 0.5, Duplicate: 0.5, MaxLength: 30, MaxBlock: 4}
+	p := numberedProgram(10)
+	for i := 0; i < 100; i++ {
+		m.Apply(p, r)
+		if len(p.instructions) > m.MaxLength {
+			t.Fatal("Program length", len(p.instructions), "exceeds", m.MaxLength)
+		}
+	}
+	if len(p.instructions) < 25 {
+		t.Error("Expected the program to grow, length is", len(p.instructions))
+	}
+	m = StructuralMutation{Delete: 1}
+	for i := 0; i < 100; i++ {
+		m.Apply(p, r)
+	}
+	if len(p.instructions) != 0 {
+		t.Error("Expected all instructions to be deleted")
+	}
+	if m.Apply(p, r) {
+		t.Error("Can't delete from an empty program")
+	}
+}
+
+// Swap and move shall keep all instructions
+func TestStructuralPermutation(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	m := StructuralMutation{Swap: 0.5, Move: 0.5, MaxBlock: 3}
+	p := numberedProgram(10)
+	for i := 0; i < 100; i++ {
+		m.Apply(p, r)
+	}
+	var seen [10]bool
+	for _, ins := range p.instructions {
+		seen[ins.addImmediate-1] = true
+	}
+	for i := range seen {
+		if !seen[i] {
+			t.Error("Lost instruction", i+1, "in", p)
+		}
+	}
+	if len(p.instructions) != 10 {
+		t.Error("Expected length 10, got", len(p.instructions))
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	pl := Pipeline{&StructuralMutation{Insert: 1}, BitMutation{Prob: 0.5}}
+	p := numberedProgram(5)
+	if !pl.Apply(p, r) {
+		t.Error("Expected the pipeline to change the program")
+	}
+	if len(p.instructions) != 6 {
+		t.Error("Expected 6 instructions, got", len(p.instructions))
+	}
+	if (Pipeline{BitMutation{Prob: 0}}).Apply(p, r) {
+		t.Error("Expected no change with probability 0")
+	}
+}
@@ -18,14 +18,48 @@
 package main
 
 import (
-	"Aldcran/MergePrograms"
 	"Aldcran/VirtualMachine"
+	"flag"
 	"fmt"
+	"log"
+	"os"
 )
 
 var virtualMachine = vm.New(16, 10)
 
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: aldcran [command] [arguments]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  list    List the contents of an archive file")
+	fmt.Fprintln(os.Stderr, "  run     Start an evolutionary run")
+	fmt.Fprintln(os.Stderr, "  resume  Continue a run from a checkpoint")
+	fmt.Fprintln(os.Stderr, "  diff    Show the differences between two programs in an archive file")
+	fmt.Fprintln(os.Stderr, "  lineage Show the ancestry of a program and the operators that created it")
+	fmt.Fprintln(os.Stderr, "Without a command, the virtual machine is printed.")
+}
+
 func main() {
-	merge.Test()
-	fmt.Println(virtualMachine)
+	flag.Usage = usage
+	flag.Parse()
+	var err error
+	switch flag.Arg(0) {
+	case "":
+		fmt.Println(virtualMachine)
+	case "list":
+		err = list(flag.Args()[1:])
+	case "run":
+		err = run(flag.Args()[1:])
+	case "resume":
+		err = resume(flag.Args()[1:])
+	case "diff":
+		err = diff(flag.Args()[1:])
+	case "lineage":
+		err = lineage(flag.Args()[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
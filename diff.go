@@ -0,0 +1,80 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"Aldcran/Archive"
+	"Aldcran/VirtualMachine"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Show the differences between two individuals in an archive file. With only one id,
+// the individual is compared with its first parent.
+func diff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: aldcran diff [flags] archive id [id]")
+		flags.PrintDefaults()
+	}
+	width := flags.Uint("width", 16, "Number of bits in the graycode of the virtual machine")
+	context := flags.Int("context", 3, "Number of unchanged instructions shown around changes")
+	flags.Parse(args)
+	if flags.NArg() != 2 && flags.NArg() != 3 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var ids []uint64
+	for _, arg := range flags.Args()[1:] {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad id %q", arg)
+		}
+		ids = append(ids, id)
+	}
+	r, err := archive.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	b, err := r.Get(ids[len(ids)-1])
+	if err != nil {
+		return err
+	}
+	if len(ids) == 1 {
+		if len(b.Parents) == 0 {
+			return fmt.Errorf("individual %d has no parents", b.Id)
+		}
+		ids = append([]uint64{b.Parents[0]}, ids...)
+	}
+	a, err := r.Get(ids[0])
+	if err != nil {
+		return err
+	}
+	m := vm.New(uint32(*width), 0)
+	pa, pb := m.NewProgram(), m.NewProgram()
+	if err := pa.UnmarshalBinary(a.Genome); err != nil {
+		return err
+	}
+	if err := pb.UnmarshalBinary(b.Genome); err != nil {
+		return err
+	}
+	return vm.WriteDiff(os.Stdout, fmt.Sprintf("id %d", a.Id), pa, fmt.Sprintf("id %d", b.Id), pb, *context)
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"Aldcran/Archive"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Show the ancestry of an individual in an archive file, and which genetic operators
+// contributed to it. The default is the best individual in the archive. Elites are only
+// recorded when they are created, so the last generation need not contain the best.
+func lineage(args []string) error {
+	flags := flag.NewFlagSet("lineage", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: aldcran lineage archive [id]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	r, err := archive.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	entries := r.Entries()
+	if len(entries) == 0 {
+		return fmt.Errorf("%s is empty", flags.Arg(0))
+	}
+	var id uint64
+	if flags.NArg() == 2 {
+		id, err = strconv.ParseUint(flags.Arg(1), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad id %q", flags.Arg(1))
+		}
+	} else {
+		id = bestId(entries)
+	}
+	ancestry := archive.Ancestry(entries, id)
+	if len(ancestry) == 0 {
+		return archive.ErrNotFound
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "id\tgeneration\tfitness\tdelta\toperator\tparents\t")
+	for _, e := range ancestry {
+		operator := e.Operator
+		if len(e.Parents) == 0 {
+			operator = "random"
+		} else if operator == "" {
+			operator = "copy"
+		}
+		fmt.Fprintf(w, "%d\t%d\t%g\t%g\t%s\t%v\t\n", e.Id, e.Generation, e.Fitness, e.Delta, operator, e.Parents)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nOperators in the ancestry of %d:\n", id)
+	if err := writeContributions(os.Stdout, archive.Contributions(ancestry)); err != nil {
+		return err
+	}
+	fmt.Println("\nOperators in the whole archive:")
+	return writeContributions(os.Stdout, archive.Contributions(entries))
+}
+
+// The individual with the lowest fitness. Of equally fit individuals, the latest is used.
+func bestId(entries []archive.Entry) uint64 {
+	best := entries[0]
+	for _, e := range entries[1:] {
+		if e.Fitness < best.Fitness || e.Fitness == best.Fitness && e.Generation >= best.Generation {
+			best = e
+		}
+	}
+	return best.Id
+}
+
+func writeContributions(out io.Writer, stats []archive.OperatorStats) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "operator\tchildren\timprovements\trate\tgain\t")
+	for _, s := range stats {
+		operator := s.Operator
+		if operator == "" {
+			operator = "copy"
+		}
+		rate := float64(s.Improvements) / float64(s.Children)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.3f\t%g\t\n", operator, s.Children, s.Improvements, rate, s.Gain)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,57 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"Aldcran/Archive"
+	"Aldcran/VirtualMachine"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// List the individuals in an archive file
+func list(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: aldcran list [flags] archive")
+		flags.PrintDefaults()
+	}
+	generation := flags.Int("generation", -1, "Only list individuals from this generation")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	r, err := archive.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "id\tgeneration\tfitness\tpenalties\tinstructions\tparents\t")
+	for _, e := range r.Entries() {
+		if *generation >= 0 && e.Generation != *generation {
+			continue
+		}
+		instructions := r.Size(e.Id) / vm.InstructionSize
+		fmt.Fprintf(w, "%d\t%d\t%g\t%d\t%d\t%v\t\n", e.Id, e.Generation, e.Fitness, e.Penalties, instructions, e.Parents)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,226 @@
+// Copyright 2014 Lars Pensjö
+//
+// This file is part of Aldcran.
+//
+// Aldcran is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, version 3.
+//
+// Aldcran is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with Aldcran.  If not, see <http://www.gnu.org/licenses/>.
+//
+
+package main
+
+import (
+	"Aldcran/Evolve"
+	"Aldcran/Problems"
+	"Aldcran/VirtualMachine"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+)
+
+// Set up the parts of the engine that are not saved in a checkpoint. It has to be done
+// the same way for a resumed run, to get the same result. A resumed run already has the
+// library from the checkpoint.
+func configure(e *evolve.Engine) error {
+	e.Mutation = problems.Mutation()
+	if e.Config.Library != "" {
+		if e.VM().Library() == nil {
+			l, err := loadLibrary(e.Config.Library)
+			if err != nil {
+				return err
+			}
+			l.Init = 0.5
+			e.VM().SetLibrary(l)
+		}
+		e.Mutation = vm.Pipeline{vm.LibraryInsert{Prob: 0.05, MaxLength: 100}, e.Mutation}
+	}
+	e.OnGeneration = func(s evolve.Stats) {
+		fmt.Printf("%d: best %g mean %g length %.1f diversity %.1f\n", s.Generation, s.Best, s.Mean, s.MeanLength, s.Diversity)
+	}
+	return nil
+}
+
+// A library file that does not exist yet is an empty library
+func loadLibrary(name string) (*vm.Library, error) {
+	l, err := vm.LoadLibrary(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &vm.Library{}, nil
+	}
+	return l, err
+}
+
+// Evolve until done or interrupted. An interrupted run is saved as a checkpoint.
+func evolveEngine(e *evolve.Engine) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	best := e.RunContext(ctx)
+	if err := e.Err(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		if err := e.SaveFile(e.Config.Checkpoint); err != nil {
+			return err
+		}
+		fmt.Println("Interrupted, checkpoint saved in", e.Config.Checkpoint)
+		return nil
+	}
+	return printBest(e, best)
+}
+
+// Evolve islands until done or interrupted. An interrupted run is saved as a checkpoint.
+func evolveIslands(is *evolve.Islands) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	best := is.RunContext(ctx)
+	if err := is.Err(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		if err := is.SaveFile(is.Checkpoint); err != nil {
+			return err
+		}
+		fmt.Println("Interrupted, checkpoint saved in", is.Checkpoint)
+		return nil
+	}
+	return printBest(is.Engines[0], best) // All islands use the same library file
+}
+
+// Print the best program, and add it to the library of e, if any
+func printBest(e *evolve.Engine, best *evolve.Individual) error {
+	p := e.VM().NewProgram()
+	p.UnmarshalBinary(best.Genome)
+	fmt.Printf("Best fitness %g, id %d:\n%v", best.Result.Fitness, best.Id, p)
+	if l := e.VM().Library(); l != nil {
+		s := l.Add(p, e.Config.Problem, best.Result.Fitness)
+		fmt.Println("Added to the library as subroutine", s.Id)
+		return l.Save(e.Config.Library)
+	}
+	return nil
+}
+
+// The reference configuration of the problem, with the defaults of the run command
+func runConfig(b *problems.Benchmark) (evolve.Config, int) {
+	c := b.Config
+	c.Checkpoint = "aldcran.ckpt"
+	c.CheckpointEvery = 10
+	return c, b.Islands
+}
+
+// The flags of the run command, with the values in c and islands as defaults
+func runFlags(c *evolve.Config, islands *int) *flag.FlagSet {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: aldcran run [flags]")
+		fmt.Fprintln(os.Stderr, "The defaults are from the reference configuration of the problem, shown here for", c.Problem)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&c.Problem, "problem", c.Problem, "Name of the problem")
+	flags.IntVar(islands, "islands", *islands, "Number of islands, 0 for one population")
+	flags.IntVar(&c.PopulationSize, "population", c.PopulationSize, "Population size")
+	flags.IntVar(&c.Generations, "generations", c.Generations, "Number of generations")
+	flags.Int64Var(&c.Seed, "seed", c.Seed, "Random seed")
+	flags.StringVar(&c.Checkpoint, "checkpoint", c.Checkpoint, "Checkpoint file")
+	flags.IntVar(&c.CheckpointEvery, "every", c.CheckpointEvery, "Generations between checkpoints, 0 for none")
+	flags.StringVar(&c.FrontFile, "front", c.FrontFile, "Write the Pareto front to this file")
+	flags.IntVar(&c.Bloat.MaxLength, "maxlength", c.Bloat.MaxLength, "Maximum number of instructions, 0 for no limit")
+	flags.BoolVar(&c.Bloat.Parsimony, "parsimony", c.Bloat.Parsimony, "Prefer the shorter program when fitness is equal")
+	flags.Float64Var(&c.Bloat.Tarpeian, "tarpeian", c.Bloat.Tarpeian, "Probability to reject children longer than the mean")
+	flags.BoolVar(&c.Bloat.Covariant, "covariant", c.Bloat.Covariant, "Use covariant parsimony pressure")
+	flags.Float64Var(&c.SuccessRule, "successrule", c.SuccessRule, "Initial rate of a bit mutation adapted with the 1/5th success rule, 0 for none")
+	flags.StringVar(&c.Archive, "archive", c.Archive, "Record every individual in this archive file")
+	flags.StringVar(&c.Library, "library", c.Library, "Subroutine library to use, and add the best program to")
+	return flags
+}
+
+// Start a new run, with the reference configuration of the problem changed by the flags
+func run(args []string) error {
+	b, err := problems.Get("increment")
+	if err != nil {
+		return err
+	}
+	c, islands := runConfig(b)
+	runFlags(&c, &islands).Parse(args)
+	if c.Problem != b.Name {
+		// Parse again, with the defaults of the problem
+		if b, err = problems.Get(c.Problem); err != nil {
+			return err
+		}
+		c, islands = runConfig(b)
+		runFlags(&c, &islands).Parse(args)
+	}
+	if islands > 0 {
+		is := evolve.NewIslands(islands, c, b.Objective)
+		for _, e := range is.Engines {
+			if err := configure(e); err != nil {
+				return err
+			}
+		}
+		return evolveIslands(is)
+	}
+	e := evolve.New(c, b.Objective)
+	if err := configure(e); err != nil {
+		return err
+	}
+	return evolveEngine(e)
+}
+
+// Continue a run from a checkpoint
+func resume(args []string) error {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: aldcran resume [flags] checkpoint")
+		flags.PrintDefaults()
+	}
+	generations := flags.Int("generations", 0, "Change the total number of generations")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	name := flags.Arg(0)
+	e, err := evolve.ResumeFile(name, nil)
+	if err != nil {
+		// It may be a checkpoint of islands
+		is, islandsErr := evolve.ResumeIslandsFile(name, nil)
+		if islandsErr != nil {
+			return err
+		}
+		for _, e := range is.Engines {
+			if err := prepare(e, *generations); err != nil {
+				return err
+			}
+		}
+		is.Checkpoint = name
+		return evolveIslands(is)
+	}
+	if err := prepare(e, *generations); err != nil {
+		return err
+	}
+	e.Config.Checkpoint = name
+	return evolveEngine(e)
+}
+
+// Set up a resumed engine for its problem, and change the number of generations if it is not 0
+func prepare(e *evolve.Engine, generations int) error {
+	b, err := problems.Get(e.Config.Problem)
+	if err != nil {
+		return err
+	}
+	e.Objective = b.Objective
+	if generations > 0 {
+		e.Config.Generations = generations
+	}
+	return configure(e)
+}